@@ -0,0 +1,52 @@
+package pipedream
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Backend is the storage service that multipart uploads are sent to. By
+// default uploads go to S3, or whatever S3 compatible service the endpoint
+// points at, but any service that can assemble an object from parts can be
+// used by implementing Backend and setting MultipartUpload.Backend.
+//
+// Requests are described with the S3 types, so that settings like checksums
+// and Object Lock reach the backend; backends are free to ignore what they
+// don't support. Methods may be called from more than one goroutine at once,
+// for different uploads.
+type Backend interface {
+	// CreateUpload starts a multipart upload, returning its ID in UploadId.
+	CreateUpload(ctx context.Context, input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+
+	// UploadPart sends one part of an upload, returning its ETag.
+	UploadPart(ctx context.Context, input *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+
+	// Complete assembles the object from the uploaded parts.
+	Complete(ctx context.Context, input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+
+	// Abort cancels an upload, discarding any parts already sent.
+	Abort(ctx context.Context, input *s3.AbortMultipartUploadInput) error
+}
+
+// s3Backend is the default Backend, which sends uploads to S3.
+type s3Backend struct {
+	svc *s3.S3
+}
+
+func (b s3Backend) CreateUpload(ctx context.Context, input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return b.svc.CreateMultipartUploadWithContext(ctx, input)
+}
+
+func (b s3Backend) UploadPart(ctx context.Context, input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return b.svc.UploadPartWithContext(ctx, input)
+}
+
+func (b s3Backend) Complete(ctx context.Context, input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	return b.svc.CompleteMultipartUploadWithContext(ctx, input)
+}
+
+func (b s3Backend) Abort(ctx context.Context, input *s3.AbortMultipartUploadInput) error {
+	_, err := b.svc.AbortMultipartUploadWithContext(ctx, input)
+	return err
+}
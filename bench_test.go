@@ -0,0 +1,115 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// benchSize is how much each benchmark sends per operation.
+const benchSize = 32 * pipedream.Megabyte
+
+// sendAndWait uploads r with a copy of m and waits for it to finish.
+func sendAndWait(m pipedream.MultipartUpload, r io.Reader, path string) error {
+	for e := range m.Send(r, path) {
+		switch e := e.(type) {
+		case pipedream.Error:
+			return e.Err
+		case pipedream.Complete:
+			return nil
+		}
+	}
+	return errors.New("upload ended without completing")
+}
+
+// BenchmarkUpload measures uploading a stream at a few part sizes. The
+// service is a stub on the loopback interface, so it's pipedream's overhead
+// that's measured rather than a network's.
+func BenchmarkUpload(b *testing.B) {
+	data := testData(int(benchSize))
+	for _, partSize := range []int64{pipedream.MinPartSize, 16 * pipedream.Megabyte} {
+		b.Run(fmt.Sprintf("part=%dMB", partSize/pipedream.Megabyte), func(b *testing.B) {
+			_, m := newStub(b)
+			m.MaxPartSize = partSize
+			b.SetBytes(benchSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sendAndWait(m, bytes.NewReader(data), "bench"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConcurrentUploads measures several uploads running at once,
+// splitting the same amount of data between them.
+func BenchmarkConcurrentUploads(b *testing.B) {
+	for _, n := range []int{1, 2, 4, 8} {
+		data := testData(int(benchSize) / n)
+		b.Run(fmt.Sprintf("uploads=%d", n), func(b *testing.B) {
+			_, m := newStub(b)
+			b.SetBytes(benchSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				errs := make(chan error, n)
+				for j := 0; j < n; j++ {
+					wg.Add(1)
+					go func(j int) {
+						defer wg.Done()
+						errs <- sendAndWait(m, bytes.NewReader(data), fmt.Sprint("bench/", j))
+					}(j)
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSendAll measures uploading several streams with SendAll at
+// different levels of concurrency.
+func BenchmarkSendAll(b *testing.B) {
+	const inputs = 8
+	data := testData(int(benchSize / inputs))
+	for _, jobs := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			_, m := newStub(b)
+			b.SetBytes(benchSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				readers := make([]pipedream.NamedReader, inputs)
+				for j := range readers {
+					readers[j] = pipedream.NamedReader{
+						Name:   fmt.Sprint(j),
+						Reader: struct{ io.Reader }{bytes.NewReader(data)},
+					}
+				}
+				ch, err := m.SendAll(context.Background(), readers, "bench/{name}", jobs)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for e := range ch {
+					switch ev := e.Event.(type) {
+					case pipedream.Error:
+						b.Fatal(ev.Err)
+					case pipedream.Aborted:
+						b.Fatal(ev.Reason)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package pipedream
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// isARN returns whether a bucket was given as an ARN, such as that of an
+// access point, rather than as a plain bucket name.
+func isARN(bucket string) bool {
+	return arn.IsARN(bucket)
+}
+
+// validateBucketARN checks that an ARN given as a bucket is one we can upload
+// to.
+func validateBucketARN(bucket string) error {
+	a, err := arn.Parse(bucket)
+	if err != nil {
+		return fmt.Errorf("invalid bucket ARN: %v", err)
+	}
+	if !strings.HasPrefix(a.Service, "s3") {
+		return fmt.Errorf("bucket ARN is for %s, not S3", a.Service)
+	}
+	if a.Region == "" {
+		// Multi-region access points have no region and must be signed with
+		// SigV4a, which the AWS SDK we're using doesn't implement.
+		return errors.New("multi-region access points aren't supported; use the ARN of a regional access point instead")
+	}
+	return nil
+}
+
+// ensureBucket creates the bucket if it doesn't already exist, turning on
+// versioning if asked. Buckets that already exist are left as they are.
+func (m *transfer) ensureBucket() error {
+	_, err := m.svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(m.Bucket)})
+	if err == nil {
+		return nil
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); !ok || reqErr.StatusCode() != http.StatusNotFound {
+		return fmt.Errorf("could not check whether bucket %s exists: %v", m.Bucket, err)
+	}
+	return m.makeBucket(m.svc)
+}
+
+// MakeBucket creates the bucket in the configured region, turning on
+// versioning if EnableVersioning is set and Object Lock if ObjectLockMode or
+// LegalHold are. It fails if the bucket already exists.
+func (m MultipartUpload) MakeBucket() error {
+	svc, err := m.newClient()
+	if err != nil {
+		return err
+	}
+	return m.makeBucket(svc)
+}
+
+// makeBucket creates the bucket with svc and waits for it to be ready.
+func (m MultipartUpload) makeBucket(svc *s3.S3) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(m.Bucket)}
+
+	// us-east-1 is the default location and must not be given explicitly.
+	if region := aws.StringValue(svc.Config.Region); region != "" && region != DefaultRegion {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+
+	// Object Lock can only be turned on when a bucket is created.
+	if m.ObjectLockMode != "" || m.LegalHold {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+
+	if _, err := svc.CreateBucket(input); err != nil {
+		return fmt.Errorf("could not create bucket %s: %w", m.Bucket, err)
+	}
+	if err := svc.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(m.Bucket)}); err != nil {
+		return fmt.Errorf("bucket %s was created but isn't available yet: %v", m.Bucket, err)
+	}
+
+	if m.EnableVersioning {
+		_, err := svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+			Bucket: aws.String(m.Bucket),
+			VersioningConfiguration: &s3.VersioningConfiguration{
+				Status: aws.String(s3.BucketVersioningStatusEnabled),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not enable versioning on bucket %s: %v", m.Bucket, err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveBucket deletes the bucket, which must be empty unless force is set.
+// With force, every object in it is deleted first, including old versions,
+// and any incomplete uploads are aborted.
+func (m MultipartUpload) RemoveBucket(force bool) error {
+	svc, err := m.newClient()
+	if err != nil {
+		return err
+	}
+	if force {
+		if err := m.emptyBucket(svc); err != nil {
+			return err
+		}
+	}
+	_, err = svc.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(m.Bucket)})
+	return err
+}
+
+// emptyBucket deletes everything in the bucket.
+func (m MultipartUpload) emptyBucket(svc *s3.S3) error {
+	var abortErr error
+	err := svc.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(m.Bucket),
+	}, func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+		for _, u := range page.Uploads {
+			_, abortErr = svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(m.Bucket),
+				Key:      u.Key,
+				UploadId: u.UploadId,
+			})
+			if isNoSuchUpload(abortErr) {
+				// It finished or was aborted in the meantime.
+				abortErr = nil
+			}
+			if abortErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if isNoSuchUpload(err) {
+		// Some services say this when there are no uploads at all.
+		err = nil
+	}
+	if err == nil {
+		err = abortErr
+	}
+	if err != nil && !notImplemented(err) {
+		return fmt.Errorf("could not abort incomplete uploads: %v", err)
+	}
+
+	objects, err := m.List("")
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(objects))
+	for i, o := range objects {
+		keys[i] = o.Key
+	}
+	if err := m.Delete(keys...); err != nil {
+		return err
+	}
+
+	// Versioned buckets keep old versions and delete markers around, which
+	// have to be deleted one by one.
+	var versions []*s3.ObjectIdentifier
+	err = svc.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(m.Bucket),
+	}, func(page *s3.ListObjectVersionsOutput, _ bool) bool {
+		for _, v := range page.Versions {
+			versions = append(versions, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, d := range page.DeleteMarkers {
+			versions = append(versions, &s3.ObjectIdentifier{Key: d.Key, VersionId: d.VersionId})
+		}
+		return true
+	})
+	if err != nil {
+		if notImplemented(err) {
+			return nil
+		}
+		return fmt.Errorf("could not list object versions: %v", err)
+	}
+	for len(versions) > 0 {
+		n := len(versions)
+		if n > maxDeleteKeys {
+			n = maxDeleteKeys
+		}
+		res, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(m.Bucket),
+			Delete: &s3.Delete{
+				Objects: versions[:n],
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(res.Errors) > 0 {
+			e := res.Errors[0]
+			return fmt.Errorf("could not delete %s: %s", aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+		versions = versions[n:]
+	}
+	return nil
+}
+
+// isNoSuchUpload reports whether err is S3 saying there's no such multipart
+// upload.
+func isNoSuchUpload(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == "NoSuchUpload"
+}
+
+// notImplemented reports whether err is the service saying it doesn't
+// support a request, as some S3 compatible services do for versioning.
+func notImplemented(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotImplemented
+}
+
+// preflight makes sure we can reach the endpoint and write to the bucket
+// before any data is read, translating failures into something a human can
+// act on.
+func (m *transfer) preflight() error {
+	_, err := m.svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(m.Bucket)})
+	if err == nil {
+		return nil
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return fmt.Errorf("could not resolve %s; check the endpoint and region", dnsErr.Name)
+	}
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoCredentialProviders" {
+		return withClass(ErrMissingCredentials, errors.New("no credentials were found; set an access key and secret key, or choose another source of credentials"))
+	}
+
+	reqErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return fmt.Errorf("could not reach bucket %s: %v", m.Bucket, err)
+	}
+	switch reqErr.StatusCode() {
+	case http.StatusNotFound:
+		return withClass(ErrBucketNotFound, fmt.Errorf("bucket %s doesn't exist; check the bucket name and endpoint", m.Bucket))
+	case http.StatusForbidden:
+		return withClass(ErrAccessDenied, fmt.Errorf("access to bucket %s was denied; check your credentials and that they're allowed to write to the bucket", m.Bucket))
+	case http.StatusMovedPermanently:
+		return fmt.Errorf("bucket %s is in a different region; check the region and endpoint", m.Bucket)
+	case http.StatusBadRequest:
+		return fmt.Errorf("the request for bucket %s was rejected; the region may be wrong or the bucket name invalid", m.Bucket)
+	}
+	return fmt.Errorf("could not reach bucket %s: %v", m.Bucket, err)
+}
@@ -0,0 +1,133 @@
+package pipedream
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ChecksumAlgorithm is an algorithm S3 can use to verify the integrity of
+// each part as it's uploaded.
+type ChecksumAlgorithm string
+
+// Supported checksum algorithms.
+const (
+	ChecksumCRC32  ChecksumAlgorithm = "CRC32"
+	ChecksumCRC32C ChecksumAlgorithm = "CRC32C"
+	ChecksumSHA1   ChecksumAlgorithm = "SHA1"
+	ChecksumSHA256 ChecksumAlgorithm = "SHA256"
+
+	// ChecksumMD5 isn't one of S3's checksum algorithms. Instead each part
+	// is sent with a Content-MD5 header, which S3 checks just the same, as
+	// happens by default anyway, for services and policies that want MD5.
+	// With Verify, the object as a whole is checked against its ETag.
+	ChecksumMD5 ChecksumAlgorithm = "MD5"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (a ChecksumAlgorithm) validate() error {
+	switch a {
+	case "", ChecksumCRC32, ChecksumCRC32C, ChecksumSHA1, ChecksumSHA256, ChecksumMD5:
+		return nil
+	}
+	return fmt.Errorf("unknown checksum algorithm %q", string(a))
+}
+
+// flexible reports whether the algorithm is one of the ones S3 sends and
+// stores in checksum fields, rather than in Content-MD5.
+func (a ChecksumAlgorithm) flexible() bool {
+	return a != "" && a != ChecksumMD5
+}
+
+// sendMD5 reports whether data should be sent with a Content-MD5 header.
+func (m MultipartUpload) sendMD5() bool {
+	switch {
+	case m.ChecksumAlgorithm == ChecksumMD5:
+		return true
+	case m.NoContentMD5:
+		return false
+	case m.ObjectLockMode != "" || m.LegalHold:
+		// Objects under Object Lock must be sent with a digest.
+		return true
+	}
+	// S3's own checksums do the job otherwise.
+	return !m.ChecksumAlgorithm.flexible()
+}
+
+// hash returns a new hash for the algorithm.
+func (a ChecksumAlgorithm) hash() hash.Hash {
+	switch a {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable)
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumMD5:
+		return md5.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// sum returns the base64 encoded checksum of the data in r, as S3 expects it.
+func (a ChecksumAlgorithm) sum(r io.ReadSeeker) (string, error) {
+	return digest(r, a.hash())
+}
+
+// digest runs the data in r through h, returning the base64 encoded result,
+// and rewinds r so it can be read again.
+func digest(r io.ReadSeeker, h hash.Hash) (string, error) {
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksums holds the checksum fields shared by the various S3 inputs and
+// outputs, only one of which is ever set.
+type checksums struct {
+	CRC32, CRC32C, SHA1, SHA256 *string
+}
+
+// fields returns checksums with the field for the algorithm set to sum.
+func (a ChecksumAlgorithm) fields(sum string) checksums {
+	var c checksums
+	switch a {
+	case ChecksumCRC32:
+		c.CRC32 = aws.String(sum)
+	case ChecksumCRC32C:
+		c.CRC32C = aws.String(sum)
+	case ChecksumSHA1:
+		c.SHA1 = aws.String(sum)
+	case ChecksumSHA256:
+		c.SHA256 = aws.String(sum)
+	}
+	return c
+}
+
+// from returns the field holding this algorithm's checksum, which may be nil.
+func (a ChecksumAlgorithm) from(c checksums) *string {
+	switch a {
+	case ChecksumCRC32:
+		return c.CRC32
+	case ChecksumCRC32C:
+		return c.CRC32C
+	case ChecksumSHA1:
+		return c.SHA1
+	case ChecksumSHA256:
+		return c.SHA256
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package pipedream
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// complete finishes up the upload, which is size bytes. This must be called
+// after all parts have been sent. Failures that might not last are retried
+// as parts are. Since a failure doesn't always mean the upload wasn't
+// completed, such as when the connection drops before the response arrives,
+// the object is checked for before giving up, when uploading to S3.
+func (m *transfer) complete(size int64) (*s3.CompleteMultipartUploadOutput, error) {
+	start := time.Now()
+	for tryNum := 1; ; tryNum++ {
+		res, err := m.completeOnce()
+		if err == nil {
+			return res, nil
+		}
+		if m.ctx.Err() != nil {
+			return nil, err
+		}
+
+		switch {
+		case isNoSuchUpload(err):
+			// An earlier attempt, ours or the SDK's, may have worked after
+			// all.
+			if res := m.completed(size, start); res != nil {
+				return res, nil
+			}
+			return nil, err
+		case !transient(err):
+			return nil, err
+		}
+		if res := m.completed(size, start); res != nil {
+			return res, nil
+		}
+
+		delay := m.RetryPolicy.delay(tryNum)
+		outOfTime := m.RetryPolicy.MaxElapsed > 0 && time.Since(start)+delay > m.RetryPolicy.MaxElapsed
+		if tryNum >= m.MaxRetries || outOfTime {
+			return nil, err
+		}
+		if m.Logger != nil {
+			m.logger().WarnContext(m.ctx, "retrying completion",
+				append([]any{
+					slog.Int("retry", tryNum),
+					slog.Int("max_retries", m.MaxRetries),
+					slog.Duration("delay", delay),
+				}, errorAttrs(err)...)...,
+			)
+		}
+		if err := wait(m.ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// completeOnce makes a single attempt at completing the upload.
+func (m *transfer) completeOnce() (*s3.CompleteMultipartUploadOutput, error) {
+	ctx, span := m.tracer().Start(m.ctx, "pipedream.CompleteMultipartUpload")
+	attemptCtx, cancel := m.attemptContext(ctx)
+	defer cancel()
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:   m.res.Bucket,
+		Key:      m.res.Key,
+		UploadId: m.res.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: m.completedParts,
+		},
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	res, err := m.backend.Complete(attemptCtx, input)
+	err = m.attemptTimedOut(ctx, attemptCtx, err, "completing the upload")
+	endSpan(span, err)
+	return res, err
+}
+
+// completed checks whether the upload was completed after all, despite a
+// request failing, returning the object in the form of a completed upload if
+// it was. It's only possible with S3, and returns nil if it can't tell.
+func (m *transfer) completed(size int64, since time.Time) *s3.CompleteMultipartUploadOutput {
+	if m.svc == nil {
+		return nil
+	}
+	input := &s3.HeadObjectInput{
+		Bucket: m.res.Bucket,
+		Key:    m.res.Key,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	head, err := m.svc.HeadObjectWithContext(m.ctx, input)
+	if err != nil {
+		m.logWarning("could not check whether the upload was completed", err)
+		return nil
+	}
+	etag, want := aws.StringValue(head.ETag), multipartETag(m.completedParts)
+	switch {
+	case want != "" && etag == want:
+		// It's ours.
+	case want != "" && strings.Contains(etag, "-"):
+		// It's from some other multipart upload.
+		return nil
+	case aws.Int64Value(head.ContentLength) != size || aws.TimeValue(head.LastModified).Before(since.Truncate(time.Second)):
+		// Without ETags in S3's style to go on, settle for an object of the
+		// right size that was written since we started completing.
+		return nil
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    m.res.Bucket,
+		Key:       m.res.Key,
+		ETag:      head.ETag,
+		VersionId: head.VersionId,
+	}
+}
+
+// multipartETag works out the ETag S3 gives an object uploaded in the given
+// parts: the MD5 of their MD5s, followed by the number of parts. It returns
+// an empty string if the parts' ETags aren't MD5s, as with some kinds of
+// encryption.
+func multipartETag(parts []*s3.CompletedPart) string {
+	h := md5.New()
+	for _, p := range parts {
+		sum, err := hex.DecodeString(strings.Trim(aws.StringValue(p.ETag), `"`))
+		if err != nil || len(sum) != md5.Size {
+			return ""
+		}
+		h.Write(sum)
+	}
+	return fmt.Sprintf(`"%x-%d"`, h.Sum(nil), len(parts))
+}
+
+// transient reports whether a request that failed with err might succeed if
+// tried again: it didn't get a response, or the response was a server error
+// or asked us to slow down.
+func transient(err error) bool {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return true
+	}
+	code := reqErr.StatusCode()
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
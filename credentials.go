@@ -0,0 +1,125 @@
+package pipedream
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newClient creates the S3 client used to talk to the storage service, or
+// returns the one we were given.
+func (m MultipartUpload) newClient() (*s3.S3, error) {
+	if m.Client != nil {
+		return m.Client, nil
+	}
+	m.setDefaults()
+	if err := m.validateAddress(); err != nil {
+		return nil, err
+	}
+	sess, err := m.newSession()
+	if err != nil {
+		return nil, err
+	}
+	svc := s3.New(sess)
+	if m.SignatureVersion == SignatureV2 {
+		useSignatureV2(svc)
+	}
+	if m.SignRequest != nil {
+		useRequestSigner(svc, m.SignRequest, m.SignatureVersion)
+	}
+	if m.DebugWriter != nil {
+		useDebugLogger(svc, m.DebugWriter)
+	}
+	return svc, nil
+}
+
+// newSession creates the AWS session used for the upload. If a role was
+// configured it's assumed before anything is sent, using either the static
+// keys, a shared config profile or the instance's credentials, so the upload
+// itself is signed with the role's temporary credentials.
+func (m MultipartUpload) newSession() (*session.Session, error) {
+	cfg := &aws.Config{}
+	if m.Endpoint != "" {
+		cfg.Endpoint = aws.String(m.Endpoint)
+	}
+	if isARN(m.Bucket) {
+		// Send requests to the access point's region.
+		cfg.S3UseARNRegion = aws.Bool(true)
+	}
+	if m.Region != "" {
+		cfg.Region = aws.String(m.Region)
+	}
+	if m.SignatureVersion == SignatureV2 {
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	if m.NoContentMD5 && !m.sendMD5() {
+		// Otherwise the SDK adds it to parts on its own.
+		cfg.S3DisableContentMD5Validation = aws.Bool(true)
+	}
+	if !m.Transport.isZero() {
+		cfg.HTTPClient = m.Transport.httpClient()
+		cfg.S3Disable100Continue = aws.Bool(m.Transport.DisableExpectContinue)
+	}
+
+	var base *credentials.Credentials
+	switch {
+	case m.Profile != "":
+		// Loading the profile resolves source_profile chains and, if we
+		// weren't given one, the profile's region.
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:            aws.Config{Region: cfg.Region},
+			Profile:           m.Profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not load profile %q: %v", m.Profile, err)
+		}
+		base = sess.Config.Credentials
+		cfg.Region = sess.Config.Region
+	case m.UseInstanceCredentials:
+		// Picks the ECS task role if we're in a container, otherwise the EC2
+		// instance profile via the metadata service.
+		base = credentials.NewCredentials(defaults.RemoteCredProvider(*defaults.Config(), defaults.Handlers()))
+	default:
+		base = credentials.NewStaticCredentials(m.AccessKey, m.SecretKey, m.SessionToken)
+	}
+
+	if aws.StringValue(cfg.Region) == "" {
+		cfg.Region = aws.String(DefaultRegion)
+	}
+
+	// STS lives on its own endpoint, so it gets a session of its own rather
+	// than the one pointed at the storage service.
+	stsSession := session.New(&aws.Config{
+		Credentials: base,
+		Region:      cfg.Region,
+	})
+
+	switch {
+	case m.WebIdentityTokenFile != "":
+		// The token is exchanged with an unsigned request, so no keys are
+		// needed here.
+		cfg.Credentials = stscreds.NewWebIdentityCredentials(stsSession, m.RoleARN, m.RoleSessionName, m.WebIdentityTokenFile)
+	case m.RoleARN != "":
+		cfg.Credentials = stscreds.NewCredentials(stsSession, m.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if m.ExternalID != "" {
+				p.ExternalID = aws.String(m.ExternalID)
+			}
+			if m.RoleSessionName != "" {
+				p.RoleSessionName = m.RoleSessionName
+			}
+			if m.RoleDuration > 0 {
+				p.Duration = m.RoleDuration
+			}
+		})
+	default:
+		cfg.Credentials = base
+	}
+
+	return session.New(cfg), nil
+}
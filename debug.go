@@ -0,0 +1,107 @@
+package pipedream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Headers whose values are secret and never written to the debug log.
+var redactedHeaders = map[string]bool{
+	"Authorization":                             true,
+	"X-Amz-Security-Token":                      true,
+	"X-Amz-Server-Side-Encryption-Customer-Key": true,
+	"Cookie": true,
+}
+
+// maxDebugBody is how much of an error response's body is shown.
+const maxDebugBody = 4096
+
+// debugLogger writes S3 requests and responses to a writer.
+type debugLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// useDebugLogger dumps the requests and responses of an S3 client to w.
+func useDebugLogger(svc *s3.S3, w io.Writer) {
+	d := &debugLogger{w: w}
+	svc.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "pipedream.DebugRequest",
+		Fn:   d.logRequest,
+	})
+	svc.Handlers.Send.PushBackNamed(request.NamedHandler{
+		Name: "pipedream.DebugResponse",
+		Fn:   d.logResponse,
+	})
+}
+
+func (d *debugLogger) logRequest(r *request.Request) {
+	req := r.HTTPRequest
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "---[ REQUEST %s, attempt %d ]---\n", r.Operation.Name, r.RetryCount+1)
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL.String())
+	writeHeaders(&b, req.Header)
+	d.write(b.String())
+}
+
+func (d *debugLogger) logResponse(r *request.Request) {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "---[ RESPONSE %s ]---\n", r.Operation.Name)
+
+	res := r.HTTPResponse
+	if res == nil {
+		fmt.Fprintf(&b, "no response: %v\n", r.Error)
+		d.write(b.String())
+		return
+	}
+
+	fmt.Fprintf(&b, "%s\n", res.Status)
+	writeHeaders(&b, res.Header)
+
+	// Error responses explain what went wrong in the body, so show it, and
+	// put it back for the SDK to parse.
+	if res.StatusCode >= 300 && res.Body != nil {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		// Shorten a copy, since the SDK is reading body.
+		shown := string(body)
+		if len(shown) > maxDebugBody {
+			shown = shown[:maxDebugBody] + "..."
+		}
+		if len(shown) > 0 {
+			fmt.Fprintf(&b, "\n%s\n", shown)
+		}
+	}
+	d.write(b.String())
+}
+
+func (d *debugLogger) write(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintln(d.w, s)
+}
+
+// writeHeaders writes HTTP headers in a stable order, redacting secrets.
+func writeHeaders(b *strings.Builder, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.Join(h[k], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			v = "[redacted]"
+		}
+		fmt.Fprintf(b, "%s: %s\n", k, v)
+	}
+}
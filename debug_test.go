@@ -0,0 +1,35 @@
+package pipedream
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestDebugLeavesLongBodiesAlone(t *testing.T) {
+	body := strings.Repeat("x", maxDebugBody) + "<Code>SlowDown</Code>"
+	r := &request.Request{
+		Operation: &request.Operation{Name: "UploadPart"},
+		HTTPResponse: &http.Response{
+			Status:     "503 Slow Down",
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		},
+	}
+	var log bytes.Buffer
+	(&debugLogger{w: &log}).logResponse(r)
+
+	// The SDK reads the body after it's been logged, to find the error.
+	got, _ := io.ReadAll(r.HTTPResponse.Body)
+	if string(got) != body {
+		t.Errorf("body was changed to %q", got[maxDebugBody:])
+	}
+	if !strings.Contains(log.String(), strings.Repeat("x", maxDebugBody)+"...\n") {
+		t.Error("logged body wasn't shortened")
+	}
+}
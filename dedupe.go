@@ -0,0 +1,89 @@
+package pipedream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// hashMetadataKey is the user metadata key holding the SHA-256 of an object's
+// content, as set by pipedream.
+const hashMetadataKey = "Pipedream-Sha256"
+
+// contentHash returns the hex encoded SHA-256 of the input: ContentHash if it
+// was given, otherwise one worked out from the input, if it can be rewound
+// afterwards. Otherwise, as with pipes, it returns "".
+func (m *transfer) contentHash() (string, error) {
+	if m.ContentHash != "" {
+		return parseContentHash(m.ContentHash)
+	}
+
+	r, ok := m.reader.(io.Seeker)
+	if !ok {
+		return "", nil
+	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// Pipes are *os.Files too, but can't seek.
+		return "", nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, m.reader); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseContentHash checks that hash is a hex encoded SHA-256, returning it in
+// lower case.
+func parseContentHash(hash string) (string, error) {
+	lower := strings.ToLower(hash)
+	if b, err := hex.DecodeString(lower); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("content hash %q isn't a hex encoded SHA-256", hash)
+	}
+	return lower, nil
+}
+
+// unchanged looks for an object at the upload's key with the given content
+// hash, returning it in the form of a completed upload if there is one. If
+// the object can't be looked at, as when the credentials can only write, the
+// object is assumed to have changed.
+func (m *transfer) unchanged(hash string) *s3.CompleteMultipartUploadOutput {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(m.path),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	res, err := m.svc.HeadObjectWithContext(m.ctx, input)
+	if err != nil {
+		return nil
+	}
+	for k, v := range res.Metadata {
+		if strings.EqualFold(k, hashMetadataKey) && strings.EqualFold(aws.StringValue(v), hash) {
+			return &s3.CompleteMultipartUploadOutput{
+				Bucket:    aws.String(m.Bucket),
+				Key:       aws.String(m.path),
+				ETag:      res.ETag,
+				VersionId: res.VersionId,
+			}
+		}
+	}
+	return nil
+}
+
+// hashMetadata returns the user metadata recording the content hash, if
+// there is one.
+func (m *transfer) hashMetadata() map[string]*string {
+	if m.hash == "" {
+		return nil
+	}
+	return map[string]*string{hashMetadataKey: aws.String(m.hash)}
+}
@@ -0,0 +1,149 @@
+package pipedream
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// awsRegionPattern matches AWS region names, like us-east-1.
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// spacesRegions are the DigitalOcean Spaces regions, which are easy to give
+// as an endpoint by mistake.
+var spacesRegions = map[string]bool{
+	"ams3": true, "blr1": true, "fra1": true, "lon1": true, "nyc3": true,
+	"sfo2": true, "sfo3": true, "sgp1": true, "syd1": true, "tor1": true,
+}
+
+// validateAddress checks the bucket, endpoints and region, as far as they'll
+// be used.
+func (m MultipartUpload) validateAddress() error {
+	if isARN(m.Bucket) {
+		return validateBucketARN(m.Bucket)
+	}
+	if m.Backend != nil {
+		return nil
+	}
+	// Other services, and AWS with path-style addressing, allow bucket names
+	// and endpoints S3's rules would reject, so those rules are only applied
+	// where they're sure to hold.
+	pathStyle := m.SignatureVersion == SignatureV2
+	if m.Bucket != "" {
+		strict := m.Client == nil && !pathStyle && isHostedEndpoint(m.Endpoint)
+		if err := validateBucketName(m.Bucket, strict); err != nil {
+			return err
+		}
+	}
+	if m.Client != nil {
+		return nil
+	}
+	for _, e := range append([]string{m.Endpoint}, m.FailoverEndpoints...) {
+		if e == "" {
+			continue
+		}
+		if err := validateEndpoint(e, m.Bucket, pathStyle); err != nil {
+			return err
+		}
+	}
+	return validateRegion(m.Region)
+}
+
+// isHostedEndpoint reports whether an endpoint is AWS's or DigitalOcean
+// Spaces', which an empty one defaults to. Both follow S3's bucket naming
+// rules and put the bucket in the host name.
+func isHostedEndpoint(endpoint string) bool {
+	if endpoint == "" {
+		return true
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	for _, domain := range []string{"amazonaws.com", "amazonaws.com.cn", "digitaloceanspaces.com"} {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBucketName checks a bucket name, so a bad one is caught here rather
+// than showing up as a DNS or signature error. Names that can't be buckets
+// anywhere are always rejected; strict also applies S3's naming rules.
+func validateBucketName(bucket string, strict bool) error {
+	switch {
+	case strings.Contains(bucket, "://"):
+		return fmt.Errorf("bucket %q looks like a URL; give just the bucket's name", bucket)
+	case strings.Contains(bucket, "/"):
+		return fmt.Errorf("bucket %q has a slash in it; bucket names can't, so put the rest in the path", bucket)
+	case !strict:
+		return nil
+	case len(bucket) < 3 || len(bucket) > 63:
+		return fmt.Errorf("bucket %q must be between 3 and 63 characters long", bucket)
+	case strings.ToLower(bucket) != bucket:
+		return fmt.Errorf("bucket %q can't have capital letters in it", bucket)
+	case strings.Trim(bucket, "abcdefghijklmnopqrstuvwxyz0123456789.-") != "":
+		return fmt.Errorf("bucket %q can only have lowercase letters, numbers, dots and hyphens in it", bucket)
+	case !isAlphanumeric(bucket[0]) || !isAlphanumeric(bucket[len(bucket)-1]):
+		return fmt.Errorf("bucket %q must start and end with a letter or a number", bucket)
+	case strings.Contains(bucket, ".."):
+		return fmt.Errorf("bucket %q can't have two dots in a row", bucket)
+	case net.ParseIP(bucket) != nil:
+		return fmt.Errorf("bucket %q looks like an IP address; did you mean it as the endpoint?", bucket)
+	}
+	return nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// validateEndpoint checks that an endpoint looks like one, catching the
+// usual mix-ups with regions and buckets.
+func validateEndpoint(endpoint, bucket string, pathStyle bool) error {
+	if awsRegionPattern.MatchString(endpoint) {
+		return fmt.Errorf("endpoint %q looks like a region; give it as the region, or use an endpoint such as s3.%s.amazonaws.com", endpoint, endpoint)
+	}
+	if spacesRegions[endpoint] {
+		return fmt.Errorf("endpoint %q looks like a region; for DigitalOcean Spaces, use %s.digitaloceanspaces.com", endpoint, endpoint)
+	}
+
+	raw := endpoint
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("endpoint %q isn't a valid host name or URL", endpoint)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("endpoint %q has to use http or https", endpoint)
+	case u.Hostname() == "":
+		return fmt.Errorf("endpoint %q is missing a host name", endpoint)
+	case strings.ContainsAny(u.Hostname(), " _"):
+		return fmt.Errorf("endpoint %q isn't a valid host name", endpoint)
+	// Elsewhere a host starting with the bucket's name, such as
+	// backups.internal for the bucket backups, may just be its name.
+	case bucket != "" && !pathStyle && isHostedEndpoint(endpoint) && strings.HasPrefix(u.Hostname(), bucket+"."):
+		return fmt.Errorf("endpoint %q has the bucket in it; leave it out and it'll be added", endpoint)
+	case bucket != "" && strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0] == bucket:
+		return fmt.Errorf("endpoint %q has the bucket in its path; leave it out and it'll be added", endpoint)
+	}
+	return nil
+}
+
+// validateRegion catches an endpoint given as the region.
+func validateRegion(region string) error {
+	if strings.Contains(region, ".") || strings.Contains(region, "/") {
+		return fmt.Errorf("region %q looks like an endpoint; give it as the endpoint, and the region as something like %s", region, DefaultRegion)
+	}
+	return nil
+}
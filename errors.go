@@ -0,0 +1,72 @@
+package pipedream
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// Errors that failures can be told apart by with errors.Is. Errors from the
+// storage service are matched to these where possible while still wrapping
+// the original, so errors.As can get at the underlying awserr.Error.
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrBucketNotFound     = errors.New("bucket not found")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrAborted            = errors.New("upload aborted")
+	ErrCancelled          = errors.New("upload cancelled")
+	ErrTooManyParts       = errors.New("too many parts")
+	ErrExists             = errors.New("object already exists")
+	ErrTimeout            = errors.New("timed out")
+	ErrTooLarge           = errors.New("input too large")
+)
+
+// classError is an error that also matches one of the exported errors.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e classError) Error() string {
+	return e.err.Error()
+}
+
+func (e classError) Unwrap() []error {
+	return []error{e.class, e.err}
+}
+
+// withClass wraps err so that it matches class with errors.Is.
+func withClass(class, err error) error {
+	return classError{class: class, err: err}
+}
+
+// classify matches an error from the storage service to one of the exported
+// errors, if it can.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ce classError
+	if errors.As(err, &ce) {
+		// Already done.
+		return err
+	}
+
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case "NoCredentialProviders":
+			return withClass(ErrMissingCredentials, err)
+		case "NoSuchBucket":
+			return withClass(ErrBucketNotFound, err)
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			return withClass(ErrAccessDenied, err)
+		}
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusForbidden {
+		return withClass(ErrAccessDenied, err)
+	}
+	return err
+}
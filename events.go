@@ -0,0 +1,131 @@
+package pipedream
+
+import "sync"
+
+// ProgressPolicy determines what happens to Progress events when the event
+// channel is full because the consumer isn't keeping up.
+type ProgressPolicy int
+
+// Available progress policies.
+const (
+	// ProgressBlock waits for the consumer, stalling the upload until the
+	// event is received. This is the default.
+	ProgressBlock ProgressPolicy = iota
+
+	// ProgressDrop discards Progress events that can't be delivered right
+	// away, and Timing events too.
+	ProgressDrop
+
+	// ProgressCoalesce holds on to Progress events that can't be delivered
+	// right away and merges them into the next one, so no bytes go
+	// unreported. Timing events can't be merged, so they're discarded.
+	ProgressCoalesce
+)
+
+// emitter delivers events to the consumer according to a ProgressPolicy.
+// Heartbeats never wait for the consumer, since the next one makes up for
+// any that are missed. Other events are always delivered, in order, up to the
+// first terminal event; anything sent after that is dropped, so the consumer
+// only ever sees one. It's safe to send from more than one goroutine.
+type emitter struct {
+	mtx     sync.Mutex
+	ch      chan Event
+	policy  ProgressPolicy
+	pending *Progress
+	ended   bool
+
+	// hook, if set, sees every event as it's sent, even ones that end up
+	// dropped.
+	hook func(Event)
+}
+
+func newEmitter(buffer int, policy ProgressPolicy) *emitter {
+	return &emitter{
+		ch:     make(chan Event, buffer),
+		policy: policy,
+	}
+}
+
+// send delivers an event.
+func (e *emitter) send(ev Event) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.ended {
+		return
+	}
+	e.ended = ev.Terminal()
+	if e.hook != nil {
+		e.hook(ev)
+	}
+
+	switch ev.(type) {
+	case Heartbeat:
+		// Waiting here would hold up everyone else sending, the part the
+		// heartbeat is about included.
+		e.offer(ev)
+		return
+	case Timing:
+		if e.policy != ProgressBlock {
+			e.offer(ev)
+			return
+		}
+	}
+	p, ok := ev.(Progress)
+	if !ok || e.policy == ProgressBlock {
+		e.flush()
+		e.ch <- ev
+		return
+	}
+
+	if e.pending != nil {
+		p.Bytes += e.pending.Bytes
+		p.Parts += e.pending.Parts
+		p.Duration += e.pending.Duration
+		p.Attempts += e.pending.Attempts
+		e.pending = nil
+	}
+
+	select {
+	case e.ch <- p:
+	default:
+		if e.policy == ProgressCoalesce {
+			e.pending = &p
+		}
+	}
+}
+
+// close delivers any coalesced Progress and closes the channel. Nothing may be
+// sent afterwards.
+func (e *emitter) close() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.flush()
+	close(e.ch)
+}
+
+// offer delivers an event if it can be right away, after any coalesced
+// Progress, and drops it otherwise.
+func (e *emitter) offer(ev Event) {
+	if e.pending != nil {
+		select {
+		case e.ch <- *e.pending:
+			e.pending = nil
+		default:
+			return
+		}
+	}
+	select {
+	case e.ch <- ev:
+	default:
+	}
+}
+
+// flush delivers any coalesced Progress, waiting for the consumer if need be.
+func (e *emitter) flush() {
+	if e.pending == nil {
+		return
+	}
+	e.ch <- *e.pending
+	e.pending = nil
+}
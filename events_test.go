@@ -0,0 +1,88 @@
+package pipedream
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEmitterProgressPolicy(t *testing.T) {
+	tests := []struct {
+		policy ProgressPolicy
+		want   []int // the Bytes of each Progress delivered
+	}{
+		{ProgressDrop, []int{1}},
+		{ProgressCoalesce, []int{1, 5}},
+	}
+	for _, tt := range tests {
+		// With room for one event and nobody reading, the first Progress
+		// fits and the rest don't.
+		e := newEmitter(1, tt.policy)
+		for i := 1; i <= 3; i++ {
+			e.send(Progress{PartNumber: i, Bytes: i, Parts: 1})
+		}
+		go e.close()
+
+		var got []int
+		for ev := range e.ch {
+			got = append(got, ev.(Progress).Bytes)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("policy %d: got Progress of %v bytes, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestEmitterDoesNotWait(t *testing.T) {
+	tests := []struct {
+		policy ProgressPolicy
+		ev     Event
+	}{
+		{ProgressBlock, Heartbeat{PartNumber: 1}},
+		{ProgressDrop, Heartbeat{PartNumber: 1}},
+		{ProgressDrop, Timing{PartNumber: 1}},
+		{ProgressCoalesce, Timing{PartNumber: 1}},
+	}
+	for _, tt := range tests {
+		// With the one place taken and nobody reading, the event has to be
+		// dropped rather than waited on.
+		e := newEmitter(1, tt.policy)
+		e.send(Progress{PartNumber: 1, Bytes: 1, Parts: 1})
+		sent := make(chan struct{})
+		go func() {
+			e.send(tt.ev)
+			close(sent)
+		}()
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("policy %d: sending a %T waited for the consumer", tt.policy, tt.ev)
+		}
+		go e.close()
+
+		var got []Event
+		for ev := range e.ch {
+			got = append(got, ev)
+		}
+		if len(got) != 1 {
+			t.Errorf("policy %d: got %v, want just the Progress", tt.policy, got)
+		}
+	}
+}
+
+func TestEmitterEndsAtTerminal(t *testing.T) {
+	e := newEmitter(3, ProgressBlock)
+	e.send(Error{errors.New("first")})
+	e.send(Error{errors.New("second")})
+	e.send(Progress{PartNumber: 1})
+	e.close()
+
+	var got []Event
+	for ev := range e.ch {
+		got = append(got, ev)
+	}
+	if len(got) != 1 || got[0].(Error).Err.Error() != "first" {
+		t.Errorf("got %v, want just the first Error", got)
+	}
+}
@@ -26,24 +26,15 @@ func main() {
 
 	// Send it up! Pipdream returns a channel where you can listen for events.
 	ch := m.Send(f, "backups/dump.rdb")
-	done := make(chan struct{})
 
-	// Listen for activity. For more detailed reporting, see the docs.
-	go func() {
-		for {
-			e := <-ch
-			switch e.(type) {
-			case pipedream.Complete:
-				fmt.Println("It worked!")
-				close(done)
-				return
-			case pipedream.Error:
-				fmt.Println("Rats, it didn't work.")
-				close(done)
-				return
-			}
+	// Listen for activity. The channel is closed once the upload is over. For
+	// more detailed reporting, see the docs.
+	for e := range ch {
+		switch e.(type) {
+		case pipedream.Complete:
+			fmt.Println("It worked!")
+		case pipedream.Error, pipedream.Aborted:
+			fmt.Println("Rats, it didn't work.")
 		}
-	}()
-
-	<-done
+	}
 }
@@ -0,0 +1,62 @@
+package pipedream
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ExistsPolicy determines what happens when there's already an object at the
+// key being uploaded to.
+type ExistsPolicy int
+
+// Available exists policies.
+const (
+	// Overwrite replaces the existing object. This is the default.
+	Overwrite ExistsPolicy = iota
+
+	// SkipIfExists leaves the existing object alone, sending a Complete with
+	// Skipped set instead of uploading.
+	SkipIfExists
+
+	// FailIfExists leaves the existing object alone and fails the upload
+	// with ErrExists.
+	FailIfExists
+)
+
+func (p ExistsPolicy) validate() error {
+	switch p {
+	case Overwrite, SkipIfExists, FailIfExists:
+		return nil
+	}
+	return fmt.Errorf("unknown exists policy %d", int(p))
+}
+
+// existing looks for an object at the upload's key, returning it in the form
+// of a completed upload if there is one. Any error other than the object not
+// being found is returned, since we can't tell whether it exists.
+func (m *transfer) existing() (*s3.CompleteMultipartUploadOutput, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(m.path),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	res, err := m.svc.HeadObjectWithContext(m.ctx, input)
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not check whether s3://%s/%s exists: %w", m.Bucket, m.path, err)
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    aws.String(m.Bucket),
+		Key:       aws.String(m.path),
+		ETag:      res.ETag,
+		VersionId: res.VersionId,
+	}, nil
+}
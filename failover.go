@@ -0,0 +1,87 @@
+package pipedream
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// uploadWithFailover performs the upload, starting over at the next of
+// FailoverEndpoints each time the endpoint can't be reached. That's only
+// possible if the input can be rewound to where it started.
+func (m *transfer) uploadWithFailover(out *emitter) Event {
+	endpoints := m.FailoverEndpoints
+	input := m.reader
+	seeker, _ := input.(io.Seeker)
+	var start int64
+	if len(endpoints) > 0 && seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	for {
+		e := m.upload(out)
+		err := eventError(e)
+		if err == nil || len(endpoints) == 0 || seeker == nil || m.ctx.Err() != nil || !unreachable(err) {
+			return e
+		}
+		if _, serr := seeker.Seek(start, io.SeekStart); serr != nil {
+			return e
+		}
+		out.send(Failover{From: m.Endpoint, To: endpoints[0], Err: err})
+		m.reset(input, endpoints[0])
+		endpoints = endpoints[1:]
+	}
+}
+
+// reset puts the transfer back the way it was before it started, to start
+// over against endpoint, reading from input.
+func (m *transfer) reset(input io.Reader, endpoint string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.Endpoint = endpoint
+	m.reader = input
+	m.svc = nil
+	m.backend = nil
+	m.res = nil
+	m.state = NotStarted
+	m.aborted = false
+	m.completedParts = nil
+	m.currentPartNumber = 0
+}
+
+// eventError returns the error an upload ended with, or nil if it succeeded.
+func eventError(e Event) error {
+	switch e := e.(type) {
+	case Error:
+		return e.Err
+	case Aborted:
+		return e.Reason
+	}
+	return nil
+}
+
+// unreachable reports whether an upload failed because the endpoint couldn't
+// be reached or stopped answering, rather than because it said no.
+func unreachable(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) {
+		// Only PartTimeout gets this far; running out of Timeout doesn't
+		// fail over.
+		return true
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == request.ErrCodeRequestError || aerr.Code() == request.ErrCodeResponseTimeout
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
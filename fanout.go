@@ -0,0 +1,106 @@
+package pipedream
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Destination is one of the places FanOut sends data to.
+type Destination struct {
+	Upload *MultipartUpload
+	Path   string
+}
+
+// FanOut uploads data from a single reader to several destinations at once,
+// reading it only once. It returns a channel of events for each destination,
+// in the same order, which behave just like the ones from Start. All of the
+// channels need to be read, or the uploads will stall.
+//
+// The input is read as fast as the slowest destination takes it. If an
+// upload fails the others carry on without it, and if reading the input
+// fails they all fail with that error. As with Start, configuration errors
+// are returned before anything's read.
+func FanOut(ctx context.Context, reader io.Reader, dests ...Destination) ([]chan Event, error) {
+	if len(dests) == 0 {
+		return nil, errors.New("no destinations")
+	}
+	if reader == nil {
+		return nil, errors.New("missing reader")
+	}
+	for _, d := range dests {
+		if d.Upload == nil {
+			return nil, errors.New("missing upload settings for " + d.Path)
+		}
+		check := *d.Upload
+		check.setDefaults()
+		if err := check.validate(); err != nil {
+			return nil, err
+		}
+		if d.Path == "" {
+			return nil, errors.New("missing path")
+		}
+	}
+
+	var (
+		chans   = make([]chan Event, len(dests))
+		writers = make([]*io.PipeWriter, len(dests))
+	)
+	for i, d := range dests {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		chans[i] = forward(d.Upload.SendContext(ctx, pr, d.Path), pr)
+	}
+
+	go func() {
+		_, err := io.Copy(&fanOutWriter{writers: append([]*io.PipeWriter(nil), writers...)}, reader)
+		for _, pw := range writers {
+			pw.CloseWithError(err)
+		}
+	}()
+
+	return chans, nil
+}
+
+// forward passes events from in to a new channel, closing pr when the upload
+// is over so anything still being written to it is dropped rather than
+// blocking the others.
+func forward(in chan Event, pr *io.PipeReader) chan Event {
+	out := make(chan Event, cap(in))
+	go func() {
+		defer close(out)
+		for e := range in {
+			if e.Terminal() {
+				pr.CloseWithError(errUploadOver)
+			}
+			out <- e
+		}
+		pr.CloseWithError(errUploadOver)
+	}()
+	return out
+}
+
+// errUploadOver is what writes to a finished upload's pipe fail with.
+var errUploadOver = errors.New("upload is over")
+
+// fanOutWriter writes to each of its writers in turn, leaving out any that
+// fail. It only fails once they all have.
+type fanOutWriter struct {
+	writers []*io.PipeWriter
+}
+
+func (w *fanOutWriter) Write(p []byte) (int, error) {
+	live := w.writers[:0]
+	for _, pw := range w.writers {
+		if _, err := pw.Write(p); err != nil {
+			pw.CloseWithError(err)
+			continue
+		}
+		live = append(live, pw)
+	}
+	w.writers = live
+	if len(live) == 0 {
+		return 0, errUploadOver
+	}
+	return len(p), nil
+}
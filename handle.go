@@ -0,0 +1,62 @@
+package pipedream
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Handle is an upload in progress, for when it needs stopping cleanly from
+// elsewhere, such as when a service drains on SIGTERM. Get one with Begin.
+type Handle struct {
+	events chan Event
+	done   chan struct{}
+	t      *transfer
+}
+
+// errCancelled is the reason given for uploads that are cancelled.
+var errCancelled = withClass(ErrCancelled, errors.New("upload cancelled"))
+
+// Begin is like StartContext, but returns a Handle on the upload so it can be
+// cancelled or shut down.
+func (m *MultipartUpload) Begin(ctx context.Context, reader io.Reader, path string) (*Handle, error) {
+	if err := m.check(reader, path); err != nil {
+		return nil, err
+	}
+	h := &Handle{done: make(chan struct{})}
+	h.t, h.events = m.send(ctx, reader, path, func() { close(h.done) })
+	return h, nil
+}
+
+// Events returns the upload's events, as Send would. They must still be
+// received while shutting down, or the upload can't finish.
+func (h *Handle) Events() chan Event {
+	return h.events
+}
+
+// Cancel stops the upload without waiting for it: no more input is read, the
+// request in flight is cut off and the multipart upload is aborted, after
+// which an Aborted is sent with a reason that matches ErrCancelled. If the
+// upload has already finished it does nothing.
+func (h *Handle) Cancel() {
+	h.t.cancel(errCancelled)
+}
+
+// State returns how far along the upload is.
+func (h *Handle) State() UploadState {
+	return h.t.getState()
+}
+
+// Shutdown cancels the upload and waits until it's over, with the multipart
+// upload aborted and no requests left in flight. If ctx is done first it
+// returns ctx's error, and the upload carries on shutting down in the
+// background.
+func (h *Handle) Shutdown(ctx context.Context) error {
+	h.Cancel()
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
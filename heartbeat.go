@@ -0,0 +1,71 @@
+package pipedream
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// countingBody counts how much of a part has been read by the HTTP client.
+// Seeking, as sendPart does to rewind the body before each attempt, moves the
+// count with it.
+type countingBody struct {
+	r io.ReadSeeker
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingBody) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.r.Seek(offset, whence)
+	if err == nil {
+		atomic.StoreInt64(&c.n, pos)
+	}
+	return pos, err
+}
+
+func (c *countingBody) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// startHeartbeat sends a Heartbeat for a part every HeartbeatInterval until
+// the returned stop function is called. The returned body should be sent in
+// place of the given one so the bytes in flight can be counted.
+func (m MultipartUpload) startHeartbeat(out *emitter, body io.ReadSeeker, size int64, partNum int) (io.ReadSeeker, func()) {
+	if m.HeartbeatInterval <= 0 {
+		return body, func() {}
+	}
+
+	counter := &countingBody{r: body}
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(m.HeartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				out.send(Heartbeat{
+					PartNumber: partNum,
+					InFlight:   counter.count(),
+					PartSize:   size,
+					Elapsed:    time.Since(start),
+				})
+			}
+		}
+	}()
+
+	return counter, func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,26 @@
+package pipedream
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// beforePart calls BeforePart, if it's set, for a part of size bytes.
+func (m *transfer) beforePart(partNum int, size int64) error {
+	if m.BeforePart == nil {
+		return nil
+	}
+	if err := m.BeforePart(m.ctx, partNum, size); err != nil {
+		return fmt.Errorf("part %d was refused: %w", partNum, err)
+	}
+	return nil
+}
+
+// afterPart calls AfterPart, if it's set, with how a part went.
+func (m *transfer) afterPart(partNum int, part *s3.CompletedPart, err error) {
+	if m.AfterPart == nil {
+		return
+	}
+	m.AfterPart(m.ctx, partNum, part, err)
+}
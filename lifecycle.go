@@ -0,0 +1,89 @@
+package pipedream
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// abortRuleID is the ID of the lifecycle rule EnsureAbortIncomplete adds.
+const abortRuleID = "pipedream-abort-incomplete-uploads"
+
+// EnsureAbortIncomplete makes sure the bucket has a lifecycle rule that
+// aborts incomplete multipart uploads days after they were started, so that
+// uploads left behind by runs that crashed are cleaned up eventually. Other
+// rules are kept. If a rule for the whole bucket already aborts them as soon
+// or sooner nothing is changed. It reports whether it changed anything.
+func (m MultipartUpload) EnsureAbortIncomplete(days int) (bool, error) {
+	if days < 1 {
+		return false, errors.New("days must be at least 1")
+	}
+	svc, err := m.newClient()
+	if err != nil {
+		return false, err
+	}
+
+	var rules []*s3.LifecycleRule
+	res, err := svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(m.Bucket),
+	})
+	var aerr awserr.Error
+	switch {
+	case errors.As(err, &aerr) && aerr.Code() == "NoSuchLifecycleConfiguration":
+		// There are no rules yet.
+	case err != nil:
+		return false, fmt.Errorf("could not get the lifecycle rules of bucket %s: %w", m.Bucket, err)
+	default:
+		rules = res.Rules
+	}
+
+	ours := -1
+	for i, r := range rules {
+		if aws.StringValue(r.ID) == abortRuleID {
+			ours = i
+		}
+		if abortsWithin(r, days) {
+			return false, nil
+		}
+	}
+
+	rule := &s3.LifecycleRule{
+		ID:     aws.String(abortRuleID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+		AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(int64(days)),
+		},
+	}
+	if ours >= 0 {
+		rules[ours] = rule
+	} else {
+		rules = append(rules, rule)
+	}
+	_, err = svc.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(m.Bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not set the lifecycle rules of bucket %s: %w", m.Bucket, err)
+	}
+	return true, nil
+}
+
+// abortsWithin reports whether a lifecycle rule aborts every incomplete
+// upload in the bucket within the given number of days.
+func abortsWithin(r *s3.LifecycleRule, days int) bool {
+	if aws.StringValue(r.Status) != s3.ExpirationStatusEnabled || r.AbortIncompleteMultipartUpload == nil {
+		return false
+	}
+	if aws.StringValue(r.Prefix) != "" {
+		return false
+	}
+	if f := r.Filter; f != nil && (aws.StringValue(f.Prefix) != "" || f.Tag != nil || f.And != nil || f.ObjectSizeGreaterThan != nil || f.ObjectSizeLessThan != nil) {
+		return false
+	}
+	return aws.Int64Value(r.AbortIncompleteMultipartUpload.DaysAfterInitiation) <= int64(days)
+}
@@ -0,0 +1,148 @@
+package pipedream
+
+import "sync"
+
+// Limiter caps the number of bytes buffered in memory across any number of
+// uploads. Share one between MultipartUploads to bound the memory used by a
+// process doing many uploads at once: when the budget is spent, uploads wait
+// to read their next part until other uploads have sent theirs.
+//
+// Every upload sharing a Limiter needs to be able to buffer at least one
+// part, so the budget must be at least as big as the largest MaxPartSize.
+type Limiter struct {
+	mu      sync.Mutex
+	max     int64
+	used    int64
+	waiters []*limiterWaiter
+}
+
+type limiterWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing up to maxBytes to be buffered at once.
+func NewLimiter(maxBytes int64) *Limiter {
+	return &Limiter{max: maxBytes}
+}
+
+// Max returns the budget, in bytes.
+func (l *Limiter) Max() int64 {
+	return l.max
+}
+
+// InUse returns the number of bytes currently buffered.
+func (l *Limiter) InUse() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used
+}
+
+// acquire blocks until n bytes are available, returning false if stop is
+// closed first. Waiters are served in order so large parts aren't starved by
+// small ones.
+func (l *Limiter) acquire(n int64, stop <-chan struct{}) bool {
+	l.mu.Lock()
+	if len(l.waiters) == 0 && l.used+n <= l.max {
+		l.used += n
+		l.mu.Unlock()
+		return true
+	}
+	w := &limiterWaiter{n: n, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-stop:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// We were granted the bytes just as we stopped; give them back.
+			l.used -= n
+		default:
+			for i, v := range l.waiters {
+				if v == w {
+					l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		l.wake()
+		return false
+	}
+}
+
+// release returns n bytes to the budget.
+func (l *Limiter) release(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= n
+	l.wake()
+}
+
+// wake grants bytes to as many waiters as will fit. The lock must be held.
+func (l *Limiter) wake() {
+	for len(l.waiters) > 0 {
+		w := l.waiters[0]
+		if l.used+w.n > l.max {
+			return
+		}
+		l.used += w.n
+		close(w.ready)
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// budget tracks the bytes a single upload holds from a Limiter so they can all
+// be given back when the upload ends, however it ends. A budget with a nil
+// Limiter does nothing.
+type budget struct {
+	lim    *Limiter
+	mu     sync.Mutex
+	held   int64
+	closed bool
+}
+
+func (b *budget) take(n int64, stop <-chan struct{}) bool {
+	if b.lim == nil {
+		return true
+	}
+	if !b.lim.acquire(n, stop) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		b.lim.release(n)
+		return false
+	}
+	b.held += n
+	return true
+}
+
+func (b *budget) give(n int64) {
+	if b.lim == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.held -= n
+	b.lim.release(n)
+}
+
+func (b *budget) close() {
+	if b.lim == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.lim.release(b.held)
+	b.held = 0
+}
@@ -0,0 +1,46 @@
+package pipedream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(10)
+	if !l.acquire(6, nil) {
+		t.Fatal("couldn't acquire within the budget")
+	}
+
+	got := make(chan bool)
+	go func() { got <- l.acquire(6, nil) }()
+	select {
+	case <-got:
+		t.Fatal("acquired more than the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.release(6)
+	select {
+	case ok := <-got:
+		if !ok {
+			t.Error("waiter gave up")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter wasn't woken by the release")
+	}
+	if n := l.InUse(); n != 6 {
+		t.Errorf("%d bytes in use, want 6", n)
+	}
+}
+
+func TestLimiterStop(t *testing.T) {
+	l := NewLimiter(10)
+	stop := make(chan struct{})
+	close(stop)
+	if l.acquire(20, stop) {
+		t.Error("acquired more than the budget")
+	}
+	if n := l.InUse(); n != 0 {
+		t.Errorf("%d bytes in use after giving up, want 0", n)
+	}
+}
@@ -0,0 +1,123 @@
+package pipedream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// logger returns the Logger with the upload's details attached.
+func (m *transfer) logger() *slog.Logger {
+	return m.Logger.With(
+		slog.String("bucket", m.Bucket),
+		slog.String("path", m.path),
+	)
+}
+
+// logStart logs the start of the upload, if there's a Logger.
+func (m *transfer) logStart() {
+	if m.Logger == nil {
+		return
+	}
+	m.logger().InfoContext(m.ctx, "upload started")
+}
+
+// logWarning logs something that went wrong without ending the upload, or
+// that events only report in passing, if there's a Logger.
+func (m *transfer) logWarning(msg string, err error, attrs ...any) {
+	if m.Logger == nil {
+		return
+	}
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.logger().WarnContext(ctx, msg, append(attrs, errorAttrs(err)...)...)
+}
+
+// logEvent logs an event, if there's a Logger.
+func (m *transfer) logEvent(e Event) {
+	if m.Logger == nil {
+		return
+	}
+	l := m.logger()
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	switch e := e.(type) {
+	case Progress:
+		l.DebugContext(ctx, "part uploaded",
+			slog.Int("part", e.PartNumber),
+			slog.Int("bytes", e.Bytes),
+			slog.Duration("duration", e.Duration),
+			slog.Int("attempts", e.Attempts),
+		)
+	case Timing:
+		l.DebugContext(ctx, "part timing",
+			slog.Int("part", e.PartNumber),
+			slog.Duration("read_time", e.ReadTime),
+			slog.Duration("wait_time", e.WaitTime),
+			slog.Duration("network_time", e.NetworkTime),
+		)
+	case Heartbeat:
+		l.DebugContext(ctx, "part still sending",
+			slog.Int("part", e.PartNumber),
+			slog.Int64("in_flight", e.InFlight),
+			slog.Int64("part_size", e.PartSize),
+			slog.Duration("elapsed", e.Elapsed),
+		)
+	case Retry:
+		l.WarnContext(ctx, "retrying part",
+			append([]any{
+				slog.Int("part", e.PartNumber),
+				slog.Int("retry", e.RetryNumber),
+				slog.Int("max_retries", e.MaxRetries),
+				slog.Duration("delay", e.Delay),
+			}, errorAttrs(e.Err)...)...,
+		)
+	case Failover:
+		l.WarnContext(ctx, "failing over",
+			append([]any{slog.String("from", e.From), slog.String("to", e.To)}, errorAttrs(e.Err)...)...,
+		)
+	case Replicated:
+		attrs := []any{slog.String("endpoint", e.Endpoint), slog.String("replica_bucket", e.Bucket)}
+		if e.Err != nil {
+			l.WarnContext(ctx, "could not replicate upload", append(attrs, errorAttrs(e.Err)...)...)
+			break
+		}
+		l.InfoContext(ctx, "upload replicated", attrs...)
+	case Complete:
+		l.InfoContext(ctx, "upload complete", slog.Int("bytes", e.Bytes))
+	case Aborted:
+		l.ErrorContext(ctx, "upload aborted",
+			append([]any{slog.String("upload_id", e.UploadID)}, errorAttrs(e.Reason)...)...,
+		)
+	case Error:
+		l.ErrorContext(ctx, "upload failed", errorAttrs(e.Err)...)
+	}
+}
+
+// errorAttrs returns log attributes describing an error, including the
+// details of errors from S3.
+func errorAttrs(err error) []any {
+	if err == nil {
+		return nil
+	}
+	attrs := []any{slog.String("error", err.Error())}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		attrs = append(attrs, slog.String("code", aerr.Code()))
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		attrs = append(attrs,
+			slog.Int("status", reqErr.StatusCode()),
+			slog.String("request_id", reqErr.RequestID()),
+		)
+	}
+	return attrs
+}
@@ -0,0 +1,360 @@
+package pipedream
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Object describes an object in the bucket. ContentType and Metadata, the
+// object's user metadata, are only filled in by Get and Stat.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	StorageClass string
+	Metadata     map[string]string
+}
+
+// List returns the objects in the bucket whose keys start with prefix.
+func (m MultipartUpload) List(prefix string) ([]Object, error) {
+	svc, err := m.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	err = svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(m.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.StringValue(o.Key),
+				Size:         aws.Int64Value(o.Size),
+				ETag:         strings.Trim(aws.StringValue(o.ETag), `"`),
+				LastModified: aws.TimeValue(o.LastModified),
+				StorageClass: storageClass(o.StorageClass),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// maxDeleteKeys is the most keys S3 will delete in one request.
+const maxDeleteKeys = 1000
+
+// Delete removes objects from the bucket.
+func (m MultipartUpload) Delete(keys ...string) error {
+	svc, err := m.newClient()
+	if err != nil {
+		return err
+	}
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxDeleteKeys {
+			n = maxDeleteKeys
+		}
+		batch := make([]*s3.ObjectIdentifier, n)
+		for i, k := range keys[:n] {
+			batch[i] = &s3.ObjectIdentifier{Key: aws.String(k)}
+		}
+		keys = keys[n:]
+
+		res, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(m.Bucket),
+			Delete: &s3.Delete{
+				Objects: batch,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(res.Errors) > 0 {
+			e := res.Errors[0]
+			return fmt.Errorf("could not delete %s: %s", aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
+
+// ETag returns the ETag that S3 would give r if it were uploaded with these
+// settings, so a local file can be compared with an uploaded copy without
+// downloading it. It doesn't apply to objects encrypted with KMS or customer
+// keys, whose ETags aren't digests.
+func (m MultipartUpload) ETag(r io.Reader) (string, error) {
+	m.setDefaults()
+	var (
+		whole = md5.New()
+		sums  []byte
+		parts int
+		total int64
+	)
+	for {
+		h := md5.New()
+		n, err := io.CopyN(io.MultiWriter(h, whole), r, m.partSize(parts+1))
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 {
+			break
+		}
+		sums = h.Sum(sums)
+		parts++
+		total += n
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if parts <= 1 || total < m.SinglePutThreshold {
+		// Input that fits in a part, or is under SinglePutThreshold, is sent
+		// with a plain PutObject, whose ETag is its MD5.
+		return hex.EncodeToString(whole.Sum(nil)), nil
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
+
+// Get opens an object in the bucket for reading. The caller must close it.
+// Objects encrypted with a customer-provided key need the same
+// SSECustomerKey, as they do for Stat.
+func (m MultipartUpload) Get(key string) (io.ReadCloser, Object, error) {
+	svc, err := m.newClient()
+	if err != nil {
+		return nil, Object{}, err
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	res, err := svc.GetObject(input)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return res.Body, Object{
+		Key:          key,
+		Size:         aws.Int64Value(res.ContentLength),
+		ETag:         strings.Trim(aws.StringValue(res.ETag), `"`),
+		LastModified: aws.TimeValue(res.LastModified),
+		ContentType:  aws.StringValue(res.ContentType),
+		StorageClass: storageClass(res.StorageClass),
+		Metadata:     aws.StringValueMap(res.Metadata),
+	}, nil
+}
+
+// Stat returns the details of an object in the bucket without downloading it.
+func (m MultipartUpload) Stat(key string) (Object, error) {
+	svc, err := m.newClient()
+	if err != nil {
+		return Object{}, err
+	}
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	res, err := svc.HeadObject(input)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:          key,
+		Size:         aws.Int64Value(res.ContentLength),
+		ETag:         strings.Trim(aws.StringValue(res.ETag), `"`),
+		LastModified: aws.TimeValue(res.LastModified),
+		ContentType:  aws.StringValue(res.ContentType),
+		StorageClass: storageClass(res.StorageClass),
+		Metadata:     aws.StringValueMap(res.Metadata),
+	}, nil
+}
+
+// URL returns the address of the object at key. It's only any use without
+// credentials if the object is public, as with ACL set to "public-read".
+func (m MultipartUpload) URL(key string) (string, error) {
+	svc, err := m.newClient()
+	if err != nil {
+		return "", err
+	}
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(key),
+	})
+	if err := req.Build(); err != nil {
+		return "", err
+	}
+	return req.HTTPRequest.URL.String(), nil
+}
+
+// storageClass returns the storage class S3 reported. Objects in the standard
+// class usually don't say so.
+func storageClass(class *string) string {
+	if aws.StringValue(class) == "" {
+		return s3.StorageClassStandard
+	}
+	return *class
+}
+
+// ContentHash returns the hex encoded SHA-256 of the object's content that
+// pipedream stored with it, or "" if it has none.
+func (o Object) ContentHash() string {
+	for k, v := range o.Metadata {
+		if strings.EqualFold(k, hashMetadataKey) {
+			return v
+		}
+	}
+	return ""
+}
+
+// MaxCopySize is the largest object that can be copied in a single request.
+// Copy copies larger objects in parts.
+const MaxCopySize = 5 * 1024 * Megabyte
+
+// copyPartSize is the size of the parts large objects are copied in, unless
+// they'd need more than MaxParts of them.
+const copyPartSize = 512 * Megabyte
+
+// Copy copies an object from another bucket, or this one, to key without it
+// passing through the client. Both buckets must be on the same service and
+// readable with the same credentials. The copy keeps the object's content
+// type and metadata, including any content hash, but not its ACL or Object
+// Lock settings: it gets m's instead.
+func (m MultipartUpload) Copy(srcBucket, srcKey, key string) error {
+	svc, err := m.newClient()
+	if err != nil {
+		return err
+	}
+	src, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return err
+	}
+	return m.copyObject(svc, src, srcBucket, srcKey, key)
+}
+
+// copyObject copies the object src describes to key with svc, which only has
+// to be able to write to m's bucket and read the source.
+func (m MultipartUpload) copyObject(svc *s3.S3, src *s3.HeadObjectOutput, srcBucket, srcKey, key string) error {
+	source := url.PathEscape(srcBucket) + "/" + escapeKey(srcKey)
+	if aws.Int64Value(src.ContentLength) > MaxCopySize {
+		return m.copyParts(svc, src, source, key)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(m.Bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(source),
+	}
+	if m.ACL != "" {
+		input.ACL = aws.String(m.ACL)
+	}
+	if m.ObjectLockMode != "" {
+		input.ObjectLockMode = aws.String(m.ObjectLockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(m.RetainUntil)
+	}
+	if m.LegalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	_, err := svc.CopyObject(input)
+	return err
+}
+
+// copyParts copies an object too big for CopyObject with a multipart upload
+// whose parts are copied from ranges of the source.
+func (m MultipartUpload) copyParts(svc *s3.S3, src *s3.HeadObjectOutput, source, key string) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(m.Bucket),
+		Key:         aws.String(key),
+		ContentType: src.ContentType,
+		Metadata:    src.Metadata,
+	}
+	if m.ACL != "" {
+		input.ACL = aws.String(m.ACL)
+	}
+	if m.ObjectLockMode != "" {
+		input.ObjectLockMode = aws.String(m.ObjectLockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(m.RetainUntil)
+	}
+	if m.LegalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	create, err := svc.CreateMultipartUpload(input)
+	if err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   create.Bucket,
+			Key:      create.Key,
+			UploadId: create.UploadId,
+		})
+		return err
+	}
+
+	size := aws.Int64Value(src.ContentLength)
+	partSize := copyPartSize
+	if n := (size + partSize - 1) / partSize; n > MaxParts {
+		partSize = (size + MaxParts - 1) / MaxParts
+	}
+
+	var parts []*s3.CompletedPart
+	for start, num := int64(0), int64(1); start < size; start, num = start+partSize, num+1 {
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		res, err := svc.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          create.Bucket,
+			Key:             create.Key,
+			UploadId:        create.UploadId,
+			PartNumber:      aws.Int64(num),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end-1)),
+		})
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       res.CopyPartResult.ETag,
+			PartNumber: aws.Int64(num),
+		})
+	}
+
+	_, err = svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          create.Bucket,
+		Key:             create.Key,
+		UploadId:        create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(err)
+	}
+	return nil
+}
+
+// escapeKey URL-escapes each segment of a key, leaving the slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
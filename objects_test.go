@@ -0,0 +1,48 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+func TestETag(t *testing.T) {
+	plain := func(data []byte) string {
+		sum := md5.Sum(data)
+		return hex.EncodeToString(sum[:])
+	}
+	data := testData(int(pipedream.MinPartSize) + 1000)
+	a, b := md5.Sum(data[:pipedream.MinPartSize]), md5.Sum(data[pipedream.MinPartSize:])
+	sum := md5.Sum(append(a[:], b[:]...))
+	multipart := fmt.Sprintf("%s-2", hex.EncodeToString(sum[:]))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		threshold int64
+		want      string
+	}{
+		{"empty", nil, 0, plain(nil)},
+		{"smaller than a part", data[:1000], 0, plain(data[:1000])},
+		{"exactly a part", data[:pipedream.MinPartSize], 0, plain(data[:pipedream.MinPartSize])},
+		{"two parts", data, 0, multipart},
+		{"under the threshold", data, 8 * pipedream.Megabyte, plain(data)},
+		{"over the threshold", data, pipedream.MinPartSize, multipart},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := pipedream.MultipartUpload{SinglePutThreshold: tt.threshold}
+			got, err := m.ETag(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package pipedream
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a MultipartUpload made with New.
+type Option func(*MultipartUpload)
+
+// New returns a MultipartUpload configured with the given options. Unlike
+// setting up a MultipartUpload directly, the configuration is checked here,
+// so mistakes like a missing bucket come back as an error right away rather
+// than as an Error event once the upload has started.
+func New(opts ...Option) (*MultipartUpload, error) {
+	m := &MultipartUpload{}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// Check the settings as they'll be used, but leave the defaults to be
+	// filled in at upload time like they would be otherwise.
+	check := *m
+	check.setDefaults()
+	if err := check.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WithEndpoint sets the endpoint to upload to.
+func WithEndpoint(endpoint string) Option {
+	return func(m *MultipartUpload) { m.Endpoint = endpoint }
+}
+
+// WithRegion sets the region.
+func WithRegion(region string) Option {
+	return func(m *MultipartUpload) { m.Region = region }
+}
+
+// WithBucket sets the bucket, or access point ARN, to upload to.
+func WithBucket(bucket string) Option {
+	return func(m *MultipartUpload) { m.Bucket = bucket }
+}
+
+// WithCredentials sets static credentials. The session token is only needed
+// for temporary credentials and can be empty.
+func WithCredentials(accessKey, secretKey, sessionToken string) Option {
+	return func(m *MultipartUpload) {
+		m.AccessKey = accessKey
+		m.SecretKey = secretKey
+		m.SessionToken = sessionToken
+	}
+}
+
+// WithProfile uses a profile from the shared AWS config and credentials
+// files for credentials.
+func WithProfile(profile string) Option {
+	return func(m *MultipartUpload) { m.Profile = profile }
+}
+
+// WithInstanceCredentials uses the ECS task role or EC2 instance profile for
+// credentials.
+func WithInstanceCredentials() Option {
+	return func(m *MultipartUpload) { m.UseInstanceCredentials = true }
+}
+
+// WithRole assumes an IAM role before uploading.
+func WithRole(roleARN, externalID string) Option {
+	return func(m *MultipartUpload) {
+		m.RoleARN = roleARN
+		m.ExternalID = externalID
+	}
+}
+
+// WithWebIdentity exchanges a web identity token, such as the one EKS mounts
+// for service accounts, for a role's credentials.
+func WithWebIdentity(roleARN, tokenFile string) Option {
+	return func(m *MultipartUpload) {
+		m.RoleARN = roleARN
+		m.WebIdentityTokenFile = tokenFile
+	}
+}
+
+// WithSignatureVersion sets the request signing version.
+func WithSignatureVersion(v SignatureVersion) Option {
+	return func(m *MultipartUpload) { m.SignatureVersion = v }
+}
+
+// WithRequestSigner calls sign with every request to the storage service,
+// before it's signed or, with SignatureCustom, to sign it.
+func WithRequestSigner(sign RequestSigner) Option {
+	return func(m *MultipartUpload) { m.SignRequest = sign }
+}
+
+// WithPreflight checks that the bucket can be reached before any data is
+// read.
+func WithPreflight() Option {
+	return func(m *MultipartUpload) { m.Preflight = true }
+}
+
+// WithMaxRetries sets the most times a part will be tried.
+func WithMaxRetries(n int) Option {
+	return func(m *MultipartUpload) { m.MaxRetries = n }
+}
+
+// WithRetryPolicy sets how long to wait between attempts at sending a part.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(m *MultipartUpload) { m.RetryPolicy = p }
+}
+
+// WithTimeouts sets how long each attempt at sending a part, and the upload
+// as a whole, can take. Zero means no limit.
+func WithTimeouts(part, overall time.Duration) Option {
+	return func(m *MultipartUpload) {
+		m.PartTimeout = part
+		m.Timeout = overall
+	}
+}
+
+// WithAbortStale aborts incomplete uploads to the same key that were started
+// longer ago than age before starting.
+func WithAbortStale(age time.Duration) Option {
+	return func(m *MultipartUpload) { m.AbortStaleAfter = age }
+}
+
+// WithPartSize sets the size of each part, in bytes.
+func WithPartSize(size int64) Option {
+	return func(m *MultipartUpload) { m.MaxPartSize = size }
+}
+
+// WithMinimumPartSize allows parts as small as size bytes, for providers that
+// accept parts smaller than MinPartSize.
+func WithMinimumPartSize(size int64) Option {
+	return func(m *MultipartUpload) { m.MinimumPartSize = size }
+}
+
+// WithAdaptivePartSize grows parts as the upload goes on, up to max bytes.
+// If max is 0 the default cap is used.
+func WithAdaptivePartSize(max int64) Option {
+	return func(m *MultipartUpload) {
+		m.AdaptivePartSize = true
+		m.MaxPartSize = max
+	}
+}
+
+// WithPartLimit sets what happens when the input is too big to fit in
+// MaxParts parts.
+func WithPartLimit(p PartLimitPolicy) Option {
+	return func(m *MultipartUpload) { m.PartLimit = p }
+}
+
+// WithSinglePutThreshold sends inputs smaller than size bytes in one request
+// rather than as a multipart upload.
+func WithSinglePutThreshold(size int64) Option {
+	return func(m *MultipartUpload) { m.SinglePutThreshold = size }
+}
+
+// WithMaxBytes aborts the upload if the input is bigger than n bytes.
+func WithMaxBytes(n int64) Option {
+	return func(m *MultipartUpload) { m.MaxBytes = n }
+}
+
+// WithIfExists sets what happens if there's already an object at the key.
+func WithIfExists(p ExistsPolicy) Option {
+	return func(m *MultipartUpload) { m.IfExists = p }
+}
+
+// WithACL gives the object a canned ACL, such as "public-read".
+func WithACL(acl string) Option {
+	return func(m *MultipartUpload) { m.ACL = acl }
+}
+
+// WithObjectLock places the object under Object Lock until the given time.
+func WithObjectLock(mode string, retainUntil time.Time) Option {
+	return func(m *MultipartUpload) {
+		m.ObjectLockMode = mode
+		m.RetainUntil = retainUntil
+	}
+}
+
+// WithLegalHold places an Object Lock legal hold on the object.
+func WithLegalHold() Option {
+	return func(m *MultipartUpload) { m.LegalHold = true }
+}
+
+// WithSSECustomerKey encrypts the object with key, a raw 32 byte AES256 key
+// that the storage service doesn't keep.
+func WithSSECustomerKey(key []byte) Option {
+	return func(m *MultipartUpload) { m.SSECustomerKey = string(key) }
+}
+
+// WithChecksumAlgorithm sends a checksum of each part using the given
+// algorithm.
+func WithChecksumAlgorithm(a ChecksumAlgorithm) Option {
+	return func(m *MultipartUpload) { m.ChecksumAlgorithm = a }
+}
+
+// WithoutContentMD5 stops parts being sent with a Content-MD5 header, for
+// providers that don't support it.
+func WithoutContentMD5() Option {
+	return func(m *MultipartUpload) { m.NoContentMD5 = true }
+}
+
+// WithLimiter shares a memory budget with other uploads.
+func WithLimiter(l *Limiter) Option {
+	return func(m *MultipartUpload) { m.Limiter = l }
+}
+
+// WithSpillToDisk keeps parts in temporary files in dir rather than in
+// memory. If dir is empty the system's temporary directory is used.
+func WithSpillToDisk(dir string) Option {
+	return func(m *MultipartUpload) {
+		m.SpillToDisk = true
+		m.SpillDir = dir
+	}
+}
+
+// WithEventBuffer sets the size of the event channel's buffer and what
+// happens to Progress events when it's full.
+func WithEventBuffer(size int, policy ProgressPolicy) Option {
+	return func(m *MultipartUpload) {
+		m.EventBuffer = size
+		m.ProgressPolicy = policy
+	}
+}
+
+// WithHeartbeatInterval sends a Heartbeat this often while a part is being
+// sent.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(m *MultipartUpload) { m.HeartbeatInterval = d }
+}
+
+// WithTransport tunes the HTTP connections to the storage service.
+func WithTransport(t TransportConfig) Option {
+	return func(m *MultipartUpload) { m.Transport = t }
+}
+
+// WithTracerProvider traces uploads with the given OpenTelemetry provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(m *MultipartUpload) { m.TracerProvider = tp }
+}
+
+// WithLogger logs upload activity.
+func WithLogger(l *slog.Logger) Option {
+	return func(m *MultipartUpload) { m.Logger = l }
+}
+
+// WithDebugWriter dumps requests and responses to w.
+func WithDebugWriter(w io.Writer) Option {
+	return func(m *MultipartUpload) { m.DebugWriter = w }
+}
+
+// WithVerify checks the object once the upload is complete.
+func WithVerify() Option {
+	return func(m *MultipartUpload) { m.Verify = true }
+}
+
+// WithContentHash stores hash, the hex encoded SHA-256 of the input, with the
+// object.
+func WithContentHash(hash string) Option {
+	return func(m *MultipartUpload) { m.ContentHash = hash }
+}
+
+// WithSkipUnchanged skips the upload if the object already exists with the
+// same content hash.
+func WithSkipUnchanged() Option {
+	return func(m *MultipartUpload) { m.SkipUnchanged = true }
+}
+
+// WithSize sets the size of the input, for reporting progress.
+func WithSize(size int64) Option {
+	return func(m *MultipartUpload) { m.Size = size }
+}
+
+// WithPartHooks calls before and after around each part. Either can be nil.
+func WithPartHooks(before func(ctx context.Context, partNum int, size int64) error, after func(ctx context.Context, partNum int, part *s3.CompletedPart, err error)) Option {
+	return func(m *MultipartUpload) {
+		m.BeforePart = before
+		m.AfterPart = after
+	}
+}
+
+// WithFailoverEndpoints falls back to endpoints, in order, if the endpoint
+// can't be reached.
+func WithFailoverEndpoints(endpoints ...string) Option {
+	return func(m *MultipartUpload) { m.FailoverEndpoints = endpoints }
+}
+
+// WithReplicateTo copies the object to r's bucket once it's uploaded.
+func WithReplicateTo(r *MultipartUpload) Option {
+	return func(m *MultipartUpload) { m.ReplicateTo = r }
+}
+
+// WithS3Client uses an S3 client that's already set up, rather than making
+// one from the credential and endpoint settings.
+func WithS3Client(c *s3.S3) Option {
+	return func(m *MultipartUpload) { m.Client = c }
+}
+
+// WithBackend sends uploads to b instead of S3.
+func WithBackend(b Backend) Option {
+	return func(m *MultipartUpload) { m.Backend = b }
+}
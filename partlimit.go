@@ -0,0 +1,77 @@
+package pipedream
+
+import "fmt"
+
+// PartLimitPolicy determines what happens when the input is too big to fit in
+// MaxParts parts of the configured size.
+type PartLimitPolicy int
+
+// Available part limit policies.
+const (
+	// PartLimitFail fails the upload with ErrTooManyParts. If the size of the
+	// input is known it fails before anything is sent, saying how big the
+	// parts need to be; otherwise it fails when it runs out of parts. This is
+	// the default.
+	PartLimitFail PartLimitPolicy = iota
+
+	// PartLimitGrow makes the parts bigger as needed. If the size of the
+	// input is known the parts are made big enough from the start.
+	// Otherwise, once every 1,000 parts the part size doubles from
+	// MinPartSize if it isn't already bigger, so the upload can reach S3's
+	// largest object size of 5TB; bear in mind parts are held in memory, or
+	// on disk with SpillToDisk, and the later ones get large. With a Limiter
+	// they can't grow past its budget, and the upload fails if they'd need
+	// to.
+	PartLimitGrow
+)
+
+func (p PartLimitPolicy) validate() error {
+	switch p {
+	case PartLimitFail, PartLimitGrow:
+		return nil
+	}
+	return fmt.Errorf("unknown part limit policy %d", int(p))
+}
+
+// Capacity returns the size of the biggest input that can be uploaded in
+// MaxParts parts of the configured size, ignoring PartLimit.
+func (m MultipartUpload) Capacity() int64 {
+	m.setDefaults()
+	m.PartLimit = PartLimitFail
+	if !m.AdaptivePartSize {
+		return m.MaxPartSize * MaxParts
+	}
+	var total int64
+	for n := 1; n <= MaxParts; n++ {
+		total += m.partSize(n)
+	}
+	return total
+}
+
+// fitParts makes sure an input of the given size fits in MaxParts parts,
+// growing the parts or failing as PartLimit says.
+func (m *transfer) fitParts(size int64) error {
+	if size <= m.Capacity() {
+		// It fits as it is, so there's no need to grow the parts as we go.
+		m.PartLimit = PartLimitFail
+		return nil
+	}
+	// The smallest size that fits, to the nearest megabyte.
+	need := (size + MaxParts - 1) / MaxParts
+	need = (need + Megabyte - 1) / Megabyte * Megabyte
+	if need > maxPutSize {
+		return withClass(ErrTooManyParts, fmt.Errorf("the input is %d bytes, which is too big for a single object", size))
+	}
+	if m.PartLimit != PartLimitGrow {
+		return withClass(ErrTooManyParts, fmt.Errorf("the input is %d bytes, which needs more than %d parts of this size; use parts of at least %d bytes", size, MaxParts, need))
+	}
+	if m.Limiter != nil && need > m.Limiter.Max() {
+		return withClass(ErrTooManyParts, fmt.Errorf("the input is %d bytes, which needs parts of at least %d bytes, more than the limiter's budget of %d bytes", size, need, m.Limiter.Max()))
+	}
+	// The parts are now big enough, so there's no need to grow them as we
+	// go as well.
+	m.AdaptivePartSize = false
+	m.MaxPartSize = need
+	m.PartLimit = PartLimitFail
+	return nil
+}
@@ -0,0 +1,41 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+	"github.com/meowgorithm/pipedream/pipedreamtest"
+)
+
+func TestPartLimitGrowPastLimiter(t *testing.T) {
+	b := pipedreamtest.NewBackend()
+	m, err := pipedream.New(
+		pipedream.WithBackend(b),
+		pipedream.WithBucket("test"),
+		pipedream.WithPartLimit(pipedream.PartLimitGrow),
+		pipedream.WithLimiter(pipedream.NewLimiter(8*pipedream.Megabyte)),
+		// Too big for 10,000 parts of 8MB.
+		pipedream.WithSize(100*1024*pipedream.Megabyte),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Upload(context.Background(), bytes.NewReader(testData(1000)), "grown", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, pipedream.ErrTooManyParts) {
+			t.Errorf("got %v, want ErrTooManyParts", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("upload hung waiting for the limiter")
+	}
+}
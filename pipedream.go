@@ -36,26 +36,17 @@
 //
 //         // Send it up! Pipdream returns a channel where you can listen for events.
 //         ch := m.Send(f, "backups/dump.rdb")
-//         done := make(chan struct{})
 //
-//         // Listen for activity. For more detailed reporting, see the docs below.
-//         go func() {
-//             for {
-//                 e := <-ch
-//                 switch e.(type) {
-//                 case pipedream.Complete:
-//                     fmt.Println("It worked!")
-//                     close(done)
-//                     return
-//                 case pipedream.Error:
-//                     fmt.Println("Rats, it didn't work.")
-//                     close(done)
-//                     return
-//                }
-//            }
-//         }()
-//
-//         <-done
+//         // Listen for activity. The channel is closed once the upload is
+//         // over. For more detailed reporting, see the docs below.
+//         for e := range ch {
+//             switch e.(type) {
+//             case pipedream.Complete:
+//                 fmt.Println("It worked!")
+//             case pipedream.Error, pipedream.Aborted:
+//                 fmt.Println("Rats, it didn't work.")
+//             }
+//         }
 //     }
 //
 // There's also a command line interface available at
@@ -63,18 +54,22 @@
 package pipedream
 
 import (
-	"bytes"
+	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -86,46 +81,200 @@ const (
 	// sizes.
 	Megabyte int64 = Kilobyte * 1024
 
+	// MinPartSize is the smallest size S3 allows for any part but the last.
+	MinPartSize = Megabyte * 5
+
+	// MaxParts is the most parts S3 allows in a multipart upload.
+	MaxParts = 10000
+
 	// DefaultRegion is the region to use as a default. This should be used for
 	// services that don't use regions, like DigitalOcean spaces.
 	DefaultRegion = "us-east-1"
+
+	// ObjectLockGovernance is the Object Lock mode under which users with
+	// special permissions can still alter or delete a locked object.
+	ObjectLockGovernance = s3.ObjectLockModeGovernance
+
+	// ObjectLockCompliance is the Object Lock mode under which no one,
+	// including the root user, can alter or delete a locked object until its
+	// retention period expires.
+	ObjectLockCompliance = s3.ObjectLockModeCompliance
 )
 
 // Event represents activity that occurred during the upload. Events are sent
 // through the channel returned by MultipartUpload.Send(). To figure out which
 // event was received use a type switch or type assertion.
+//
+// Every upload ends with exactly one Complete, Error or Aborted, after which
+// the channel is closed, so it's fine to range over it. Those are the
+// terminal events, which Terminal reports, so a loop can tell it's seen the
+// last event without knowing every kind.
 type Event interface {
+	// Terminal reports whether this is the last event of an upload.
+	Terminal() bool
+
 	// This is a dummy method for type safety.
 	event()
 }
 
 // Progress is an Event indicating upload progress. It's sent when a part has
 // successfully uploaded.
+//
+// Parts is the number of parts the event covers. It's always 1 unless
+// Progress events were coalesced (see ProgressCoalesce), in which case
+// PartNumber is the most recent part and Bytes is the total for all of them.
+//
+// Duration is how long the part took to send, including any retries, and
+// Attempts is how many tries it took. Watching them shows a connection
+// getting slower part by part. Coalesced events add them up, like Bytes.
+//
+// Sent is the number of bytes uploaded so far, Elapsed is the time since the
+// upload started and Rate is the current transfer rate, in bytes per second,
+// measured over the most recent part. When the size of the input is known,
+// Size is set, as are Percent (0-100) and the estimated time remaining, ETA.
 type Progress struct {
 	PartNumber int
 	Bytes      int
+	Parts      int
+	Duration   time.Duration
+	Attempts   int
+
+	Sent    int64
+	Elapsed time.Duration
+	Rate    float64
+
+	Size    int64
+	Percent float64
+	ETA     time.Duration
 }
 
 // Retry is an Event indicating there was an error uploading a part and the
 // part is being retried. An Error will be send if the retries are exhaused and
 // the upload fails.
+//
+// Err is the error that caused the retry, and Delay is how long the
+// RetryPolicy says to wait before trying again.
 type Retry struct {
 	PartNumber  int
 	RetryNumber int
 	MaxRetries  int
+	Delay       time.Duration
+	Err         error
+}
+
+// Timing is an Event reporting where the time went for a part, sent just after
+// the part's Progress event when MultipartUpload.ReportTimings is set. It's
+// meant for tuning part sizes: if WaitTime is high the input can't keep up,
+// and if NetworkTime is high the connection is the bottleneck. Unless the
+// ProgressPolicy is ProgressBlock, Timings that can't be delivered right away
+// are dropped.
+type Timing struct {
+	PartNumber int
+	Bytes      int
+
+	// ReadTime is how long it took to read the part from the input. Parts are
+	// read ahead, so this overlaps with the previous part's NetworkTime.
+	ReadTime time.Duration
+
+	// WaitTime is how long the upload sat waiting for the part to be read
+	// after the previous part was sent.
+	WaitTime time.Duration
+
+	// NetworkTime is how long it took to send the part, including retries.
+	NetworkTime time.Duration
+}
+
+// Heartbeat is an Event sent periodically while a part is being sent, when
+// MultipartUpload.HeartbeatInterval is set, so that a slow part can be told
+// apart from a hung upload.
+//
+// InFlight is how much of the part has been handed to the connection so far,
+// out of PartSize, and Elapsed is how long the part has been sending,
+// including any retries.
+//
+// Heartbeats are dropped rather than waiting for a consumer that isn't
+// keeping up, whatever the ProgressPolicy.
+type Heartbeat struct {
+	PartNumber int
+	InFlight   int64
+	PartSize   int64
+	Elapsed    time.Duration
+}
+
+// Failover is an Event indicating that the endpoint From couldn't be reached,
+// so the upload is starting over at To, the next of
+// MultipartUpload.FailoverEndpoints. Err is why. Progress starts again from
+// the beginning.
+type Failover struct {
+	From string
+	To   string
+	Err  error
+}
+
+// Replicated is an Event reporting on the copy of the object to
+// MultipartUpload.ReplicateTo, sent just before the Complete. Err is set if
+// the copy failed, in which case the upload itself still succeeded.
+type Replicated struct {
+	Endpoint string
+	Bucket   string
+	Key      string
+	Err      error
 }
 
 // Complete is an Event sent when an upload has completed successfully. When
 // a Complete is received there will be no further activity send on the
-// channel, so you can confidently move on.
+// channel and it will be closed, so you can confidently move on.
+//
+// If the upload was skipped because the object hadn't changed, Skipped is set
+// and Result describes the existing object.
 type Complete struct {
-	Bytes  int
-	Result *s3.CompleteMultipartUploadOutput
+	Bytes   int
+	Result  *s3.CompleteMultipartUploadOutput
+	Summary Summary
+	Skipped bool
+}
+
+// Summary describes a finished upload, for reporting. Throughput is the
+// average transfer rate over the whole upload, in bytes per second.
+type Summary struct {
+	Bytes      int64
+	Parts      int
+	Retries    int
+	Duration   time.Duration
+	Throughput float64
+}
+
+// Aborted is an Event indicating that the upload failed and was aborted, so no
+// incomplete upload was left behind in the bucket. Reason is the error that
+// caused the abort. Like Complete and Error, no further activity will be sent
+// after an Aborted and the channel will be closed.
+//
+// If the upload fails and can't be aborted an Error is sent instead.
+type Aborted struct {
+	UploadID string
+	Reason   error
+}
+
+// Error returns a string representation of the reason for the abort. It
+// satisfies the Error interface.
+func (a Aborted) Error() string {
+	return "upload aborted: " + a.Reason.Error()
+}
+
+// Unwrap returns the reason for the abort.
+func (a Aborted) Unwrap() error {
+	return a.Reason
+}
+
+// Is reports whether target is ErrAborted, so errors.Is(err, ErrAborted)
+// holds for any Aborted.
+func (a Aborted) Is(target error) bool {
+	return target == ErrAborted
 }
 
 // Error is an event indicating that an Error occurred during the upload. When
-// an Error is received the operation has failed and no further activity will
-// be send, so you can confidently move on.
+// an Error is received the operation has failed, no further activity will be
+// send and the channel will be closed, so you can confidently move on.
 type Error struct {
 	Err error
 }
@@ -136,14 +285,39 @@ func (e Error) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the underlying error, so Error works with errors.Is and
+// errors.As.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
 // Implement dummy methods to satisfy Event interface. We're doing this for
 // type safety.
-func (p Progress) event() {}
-func (r Retry) event()    {}
-func (c Complete) event() {}
-func (e Error) event()    {}
+
+func (p Progress) event()   {}
+func (r Retry) event()      {}
+func (t Timing) event()     {}
+func (h Heartbeat) event()  {}
+func (f Failover) event()   {}
+func (r Replicated) event() {}
+func (c Complete) event()   {}
+func (a Aborted) event()    {}
+func (e Error) event()      {}
+
+func (p Progress) Terminal() bool   { return false }
+func (r Retry) Terminal() bool      { return false }
+func (t Timing) Terminal() bool     { return false }
+func (h Heartbeat) Terminal() bool  { return false }
+func (f Failover) Terminal() bool   { return false }
+func (r Replicated) Terminal() bool { return false }
+func (c Complete) Terminal() bool   { return true }
+func (a Aborted) Terminal() bool    { return true }
+func (e Error) Terminal() bool      { return true }
 
 // MultipartUpload handles multipart uploads to S3 and S3-compatible systems.
+//
+// Bucket may also be the ARN of an S3 access point, in which case the endpoint
+// and region are derived from the ARN and Endpoint can be left empty.
 type MultipartUpload struct {
 	Endpoint    string
 	Region      string
@@ -153,88 +327,587 @@ type MultipartUpload struct {
 	MaxRetries  int
 	MaxPartSize int64
 
-	svc               *s3.S3
-	res               *s3.CreateMultipartUploadOutput
-	completedParts    []*s3.CompletedPart
-	currentPartNumber int
-	path              string
-	reader            io.Reader
+	// MinimumPartSize is the smallest MaxPartSize allowed. It defaults to
+	// MinPartSize, since S3 rejects smaller parts other than the last one,
+	// but some providers accept smaller ones.
+	MinimumPartSize int64
+
+	// SessionToken is the token that accompanies temporary credentials, such
+	// as those issued by STS. It's not needed for long-lived keys.
+	SessionToken string
+
+	// RoleARN, if set, is an IAM role to assume before uploading. The
+	// AccessKey and SecretKey are used to assume the role, which is useful
+	// for cross-account destinations. ExternalID, RoleSessionName and
+	// RoleDuration are optional.
+	RoleARN         string
+	ExternalID      string
+	RoleSessionName string
+	RoleDuration    time.Duration
+
+	// WebIdentityTokenFile is the path to an OIDC token to exchange for the
+	// credentials of RoleARN, as with IAM roles for service accounts on EKS.
+	// When set, AccessKey and SecretKey aren't needed.
+	WebIdentityTokenFile string
+
+	// UseInstanceCredentials uses the credentials of the ECS task role or EC2
+	// instance profile instead of AccessKey and SecretKey.
+	UseInstanceCredentials bool
+
+	// Profile is the name of a profile in the shared AWS config and
+	// credentials files (~/.aws/config and ~/.aws/credentials) to take
+	// credentials from instead of AccessKey and SecretKey. If Region isn't
+	// set, the profile's region is used.
+	Profile string
+
+	// SignatureVersion is the signing scheme to use. The default, V4, is
+	// right for nearly everything; V2 is for legacy gateways.
+	SignatureVersion SignatureVersion
+
+	// SignRequest, if set, is called with every request sent to the storage
+	// service, for gateways that want more than S3 does. It's called just
+	// before the request is signed, so headers it adds are covered by the
+	// signature, or in place of signing with SignatureCustom, which needs
+	// it. It's called again if the request is retried. An error fails the
+	// request.
+	SignRequest RequestSigner
+
+	// ObjectLockMode and RetainUntil place the uploaded object under an Object
+	// Lock retention period. Both must be set together, and the bucket must
+	// have Object Lock enabled. LegalHold places a legal hold on the object,
+	// independent of any retention period.
+	ObjectLockMode string
+	RetainUntil    time.Time
+	LegalHold      bool
+
+	// CreateBucket creates the bucket, in Region, if it doesn't exist.
+	// EnableVersioning turns on versioning for buckets created this way.
+	CreateBucket     bool
+	EnableVersioning bool
+
+	// Preflight checks that the bucket can be reached with the given
+	// credentials before any data is read, so configuration problems are
+	// reported up front rather than after the first part.
+	Preflight bool
+
+	// AbortStaleAfter, if set, aborts incomplete multipart uploads to the
+	// same key that were started longer ago than this before starting, so
+	// runs that crashed part way through don't leave storage behind that's
+	// charged for but can't be seen.
+	AbortStaleAfter time.Duration
+
+	// AdaptivePartSize grows the part size as the upload goes on, which suits
+	// streams of unknown length. Parts start at MinPartSize and double every
+	// 1,000 parts up to MaxPartSize, which defaults to 512MB in this mode.
+	// Small streams stay cheap on memory while very large ones stay well
+	// under S3's limit of 10,000 parts.
+	AdaptivePartSize bool
+
+	// PartLimit determines what happens when the input is too big to fit in
+	// MaxParts parts: by default the upload fails, before anything is sent
+	// if the size of the input is known.
+	PartLimit PartLimitPolicy
+
+	// Limiter, if set, caps the memory used to buffer parts. Share one
+	// Limiter between uploads to cap memory process-wide.
+	Limiter *Limiter
+
+	// EventBuffer is the capacity of the channel returned by Send. By default
+	// it's unbuffered, so the upload waits for each event to be received.
+	EventBuffer int
+
+	// SinglePutThreshold, if set, is the size under which the input is sent
+	// as a whole object in one request rather than as a multipart upload,
+	// which saves requests for small objects. Inputs smaller than a part are
+	// always sent that way. Inputs that can't be read at an offset, like
+	// pipes, are buffered up to this size to find out how big they are, in
+	// memory counted against the Limiter or on disk with SpillToDisk. It
+	// can't be more than 5GB or the Limiter's budget, and it's ignored with a
+	// Backend.
+	SinglePutThreshold int64
+
+	// MaxBytes, if set, is the most data to upload. If the input turns out
+	// to be bigger the upload is aborted with ErrTooLarge, so that a runaway
+	// input doesn't fill the bucket.
+	MaxBytes int64
+
+	// PartTimeout, if set, is how long a single attempt at sending a part
+	// can take. An attempt that takes longer is cut off and retried, so a
+	// hung connection doesn't stall the upload. It also limits each attempt
+	// at completing the upload, and the request that sends an input small
+	// enough to go as a single object, which isn't retried.
+	PartTimeout time.Duration
+
+	// Timeout, if set, is how long the whole upload can take before it's
+	// aborted.
+	Timeout time.Duration
+
+	// RetryPolicy determines how long to wait between attempts at sending a
+	// part. By default failed parts are retried straight away.
+	RetryPolicy RetryPolicy
+
+	// ProgressPolicy determines what happens to Progress events when the
+	// event channel is full, so a slow consumer needn't stall the upload.
+	// Other events are always delivered.
+	ProgressPolicy ProgressPolicy
+
+	// ReportTimings sends a Timing event after each part.
+	ReportTimings bool
+
+	// HeartbeatInterval, if set, is how often to send a Heartbeat while a
+	// part is being sent.
+	HeartbeatInterval time.Duration
+
+	// Verify checks the object once the upload is complete, comparing its
+	// size, ETag and checksum with what was sent. A mismatch is reported as
+	// an Error. It costs an extra pass over each part and a HEAD request.
+	// With SSECustomerKey the ETag isn't compared, since it isn't made from
+	// the data.
+	Verify bool
+
+	// ContentHash is the hex encoded SHA-256 of the input, if it's known
+	// ahead of time. It's stored with the object so later uploads can tell
+	// whether anything changed.
+	ContentHash string
+
+	// SkipUnchanged skips the upload if the object already exists with the
+	// same content hash, sending a Complete with Skipped set instead. The
+	// hash is ContentHash or, if the input can seek, worked out by reading it
+	// first. Inputs that can't seek, like pipes, need ContentHash for this.
+	SkipUnchanged bool
+
+	// ACL is a canned ACL to give the object, such as "public-read" to let
+	// anyone download it. By default the bucket's settings apply.
+	ACL string
+
+	// SSECustomerKey, if set, has the object encrypted at rest with this
+	// key, which the storage service uses and then forgets. It's the raw
+	// 32 byte key, not base64 encoded, and the same key is needed to read
+	// the object back. Keys can only be sent over HTTPS.
+	// SSECustomerAlgorithm defaults to AES256, the only one S3 supports, and
+	// SSECustomerKeyMD5, the base64 encoded MD5 of the key, is worked out if
+	// it's not given.
+	SSECustomerKey       string
+	SSECustomerAlgorithm string
+	SSECustomerKeyMD5    string
+
+	// IfExists determines what to do if there's already an object at the
+	// key. By default it's overwritten; otherwise the key is checked with a
+	// HEAD request before anything is read.
+	IfExists ExistsPolicy
+
+	// Transport tunes the HTTP connections used for the upload.
+	Transport TransportConfig
+
+	// ChecksumAlgorithm, if set, has S3 verify each part against a checksum
+	// computed here as it's uploaded. Parts that arrive corrupted are
+	// rejected and retried.
+	ChecksumAlgorithm ChecksumAlgorithm
+
+	// NoContentMD5 stops parts being sent with a Content-MD5 header, for
+	// providers that don't support it. By default every part has one, so
+	// that a part corrupted on the way is rejected rather than ending up in
+	// the object. Object Lock needs either Content-MD5 or a
+	// ChecksumAlgorithm.
+	NoContentMD5 bool
+
+	// SpillToDisk keeps parts in temporary files in SpillDir, or the system's
+	// temporary directory, rather than in memory. It's slower, but makes very
+	// large parts practical on hosts short on memory. Like Limiter, it only
+	// matters for inputs that have to be buffered, like pipes; files are read
+	// a part at a time straight from disk.
+	SpillToDisk bool
+	SpillDir    string
+
+	// TracerProvider provides the OpenTelemetry tracer used to trace the
+	// upload, with a span for the upload and child spans for each part and
+	// each attempt at sending it. If it's nil the global provider is used.
+	TracerProvider trace.TracerProvider
+
+	// Logger, if set, logs the upload's progress: parts at debug level,
+	// retries as warnings, and the outcome at info or error level. Problems
+	// events don't report on their own, like failing to abort the upload or
+	// to check whether a completion that errored went through, are logged
+	// as warnings. Errors from S3 are logged with their code, status and
+	// request ID.
+	Logger *slog.Logger
+
+	// Size is the total size of the input in bytes, used to report percent
+	// complete and ETA in Progress events. It's detected automatically for
+	// files and for readers with a Len or Size method, such as
+	// bytes.Reader, but must be given for pipes.
+	Size int64
+
+	// DebugWriter, if set, receives a dump of every request sent to the
+	// storage service and its response, with credentials redacted. It's for
+	// figuring out exactly what a misbehaving gateway doesn't like.
+	DebugWriter io.Writer
+
+	// BeforePart and AfterPart, if set, are called around each part, for
+	// throttling, accounting or auditing without touching the upload itself.
+	// BeforePart is called before the part is first sent, with its size; it
+	// can block to hold the part back, but should give up when ctx is done,
+	// and an error from it fails the upload. AfterPart is called once the
+	// part has been sent, with the part as it'll be listed when the upload is
+	// completed, or once it's failed for good, with the error. An input sent
+	// as a single object counts as part 1. They're called from the upload's
+	// own goroutine, so a slow hook slows the upload down.
+	BeforePart func(ctx context.Context, partNum int, size int64) error
+	AfterPart  func(ctx context.Context, partNum int, part *s3.CompletedPart, err error)
+
+	// FailoverEndpoints, if set, are endpoints to fall back to, in order, if
+	// Endpoint can't be reached, such as a bucket replicated to another
+	// region. When a request gets no answer, even after retries, the upload
+	// is abandoned and started over at the next endpoint, with the same
+	// bucket and credentials. Only inputs that can seek, like files, can be
+	// started over; others fail as they would without a fallback.
+	FailoverEndpoints []string
+
+	// ReplicateTo, if set, is where to copy the object once it's uploaded,
+	// such as a bucket in another region, for a second copy that doesn't
+	// depend on the first. Only its endpoint, region, bucket and credentials
+	// are used, along with its ACL and Object Lock settings, which default
+	// to the upload's; the key is the same. The copy keeps the object's
+	// metadata, including its content hash. It's made by the storage
+	// service, so ReplicateTo's credentials need to be able to read the
+	// object, and it's reported with a Replicated event. A failed copy
+	// doesn't fail the upload.
+	ReplicateTo *MultipartUpload
+
+	// Client, if set, is the S3 client to use, for programs that already
+	// have one set up with their own session, endpoint resolver or request
+	// handlers. The client's own configuration is used as is, so the
+	// credential, endpoint, region, SignatureVersion, SignRequest, Transport
+	// and DebugWriter settings are ignored. It can be shared between uploads.
+	Client *s3.S3
+
+	// Backend, if set, is where uploads are sent instead of S3, in which
+	// case the credentials and endpoint settings aren't used. CreateBucket,
+	// Preflight, AbortStaleAfter, SkipUnchanged, IfExists, Verify,
+	// FailoverEndpoints and ReplicateTo need S3 and can't be used with a
+	// Backend.
+	Backend Backend
 }
 
 // Send uploads data from a given io.Reader (such as an *os.File or os.Stdin)
-// to a given path in a bucket.
+// to a given path in a bucket. Any problem, including a bad configuration, is
+// reported as an event; use Start to get configuration errors right away.
 func (m *MultipartUpload) Send(reader io.Reader, path string) chan Event {
-	m.reader = reader
-	m.path = path
-	ch := make(chan Event)
-	go m.run(ch)
+	return m.SendContext(context.Background(), reader, path)
+}
+
+// SendContext is like Send, but with a context. Trace spans for the upload are
+// created as children of any span in the context.
+//
+// Each upload takes a copy of the settings when it starts, so one
+// MultipartUpload can be used for any number of uploads, including at the
+// same time.
+func (m *MultipartUpload) SendContext(ctx context.Context, reader io.Reader, path string) chan Event {
+	_, ch := m.send(ctx, reader, path, nil)
 	return ch
 }
 
-func (m *MultipartUpload) run(ch chan Event) {
-	// Set defaults
+// send starts an upload, calling done, if given, once it's over.
+func (m *MultipartUpload) send(ctx context.Context, reader io.Reader, path string, done func()) (*transfer, chan Event) {
+	t := newTransfer(ctx, *m, reader, path)
+	out := newEmitter(m.EventBuffer, m.ProgressPolicy)
+	out.hook = t.logEvent
+	track(m, t)
+	go func() {
+		defer untrack(m, t)
+		defer t.cancel(nil)
+		if done != nil {
+			defer done()
+		}
+		t.run(out)
+	}()
+	return t, out.ch
+}
+
+// Start is like Send, but checks the configuration before starting, returning
+// an error instead of a channel if there's something wrong with it. Problems
+// that only show up once the upload is underway are still sent as events.
+func (m *MultipartUpload) Start(reader io.Reader, path string) (chan Event, error) {
+	return m.StartContext(context.Background(), reader, path)
+}
+
+// StartContext is like Start, but with a context, like SendContext.
+func (m *MultipartUpload) StartContext(ctx context.Context, reader io.Reader, path string) (chan Event, error) {
+	if err := m.check(reader, path); err != nil {
+		return nil, err
+	}
+	return m.SendContext(ctx, reader, path), nil
+}
+
+// check checks the configuration and arguments of an upload before it starts.
+func (m *MultipartUpload) check(reader io.Reader, path string) error {
+	check := *m
+	check.setDefaults()
+	if err := check.validate(); err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("missing path")
+	}
+	if reader == nil {
+		return errors.New("missing reader")
+	}
+	return nil
+}
+
+// Upload uploads data and waits for it to finish, for when you'd rather not
+// deal with events. It returns the Complete event if it succeeds, otherwise
+// an error, which is an Aborted if the upload was aborted. If onProgress
+// isn't nil it's called with each Progress event.
+func (m *MultipartUpload) Upload(ctx context.Context, reader io.Reader, path string, onProgress func(Progress)) (Complete, error) {
+	ch, err := m.StartContext(ctx, reader, path)
+	if err != nil {
+		return Complete{}, err
+	}
+	for e := range ch {
+		switch e := e.(type) {
+		case Progress:
+			if onProgress != nil {
+				onProgress(e)
+			}
+		case Complete:
+			return e, nil
+		case Aborted:
+			return Complete{}, e
+		case Error:
+			return Complete{}, e.Err
+		}
+	}
+	return Complete{}, errors.New("upload ended unexpectedly")
+}
+
+func (m *transfer) run(out *emitter) {
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		m.ctx, cancel = context.WithTimeoutCause(m.ctx, m.Timeout, withClass(ErrTimeout, fmt.Errorf("upload took longer than %s", m.Timeout)))
+		defer cancel()
+	}
+
+	var span trace.Span
+	m.ctx, span = m.tracer().Start(m.ctx, "pipedream.Upload", trace.WithAttributes(
+		attribute.String("pipedream.bucket", m.Bucket),
+		attribute.String("pipedream.path", m.path),
+	))
+	m.logStart()
+
+	e := m.uploadWithFailover(out)
+	if c, ok := e.(Complete); ok && !c.Skipped && m.ReplicateTo != nil {
+		m.replicate(out)
+	}
+	m.setState(Done)
+
+	// If we ran out of time or were cancelled, say so rather than passing
+	// on whatever the request that was cut off failed with.
+	cause := context.Cause(m.ctx)
+	if !errors.Is(cause, ErrTimeout) && !errors.Is(cause, ErrCancelled) {
+		cause = nil
+	}
+	switch ev := e.(type) {
+	case Error:
+		if errors.Is(cause, ErrCancelled) && m.res == nil {
+			// There was nothing to abort, but we stopped as asked.
+			e = Aborted{Reason: cause}
+			break
+		}
+		if cause != nil {
+			ev.Err = cause
+		}
+		ev.Err = classify(ev.Err)
+		e = ev
+	case Aborted:
+		if cause != nil {
+			ev.Reason = cause
+		}
+		ev.Reason = classify(ev.Reason)
+		e = ev
+	}
+	endUploadSpan(span, e)
+	out.send(e)
+	out.close()
+}
+
+// setDefaults fills in the settings that weren't given.
+func (m *MultipartUpload) setDefaults() {
 	if m.MaxRetries == 0 {
 		m.MaxRetries = 3
 	}
-	if m.MaxPartSize == 0 {
-		m.MaxPartSize = Megabyte * 5
+	if m.MaxPartSize == 0 && m.AdaptivePartSize {
+		m.MaxPartSize = Megabyte * 512
+	} else if m.MaxPartSize == 0 {
+		m.MaxPartSize = MinPartSize
 	}
-	if m.Endpoint == "" {
+	if m.Endpoint == "" && !isARN(m.Bucket) {
 		m.Endpoint = "nyc3.digitaloceanspaces.com"
 	}
-	if m.Region == "" {
+	if m.Region == "" && m.Profile == "" {
 		m.Region = DefaultRegion
 	}
+}
 
-	// Validate
-	var missing []string
-	if m.AccessKey == "" {
-		missing = append(missing, "AccessKey")
+// upload performs the upload, returning the event it ended with: Complete,
+// Aborted or Error.
+func (m *transfer) upload(out *emitter) Event {
+	m.setDefaults()
+	if err := m.validate(); err != nil {
+		return Error{err}
 	}
-	if m.SecretKey == "" {
-		missing = append(missing, "SecretKey")
+
+	// Init S3 session, unless we've been given somewhere else to upload to
+	var err error
+	if m.Backend != nil {
+		m.setBackend(m.Backend)
+	} else {
+		svc, err := m.newClient()
+		if err != nil {
+			return Error{err}
+		}
+		m.svc = svc
+		m.setBackend(s3Backend{svc})
 	}
-	if m.Bucket == "" {
-		missing = append(missing, "Bucket")
+
+	if m.CreateBucket {
+		if err := m.ensureBucket(); err != nil {
+			return Error{err}
+		}
 	}
-	if len(missing) > 0 {
-		ch <- Error{
-			Err: errors.New("missing " + EnglishJoin(missing, true)),
+	if m.Preflight {
+		if err := m.preflight(); err != nil {
+			return Error{err}
+		}
+	}
+	if m.AbortStaleAfter > 0 {
+		if err := m.abortStale(); err != nil {
+			return Error{err}
 		}
-		return
 	}
 
-	// Make S3 config
-	s3Config := &aws.Config{
-		Credentials: credentials.NewStaticCredentials(m.AccessKey, m.SecretKey, ""),
-		Endpoint:    aws.String(m.Endpoint),
-		Region:      aws.String(m.Region),
+	if m.IfExists != Overwrite {
+		res, err := m.existing()
+		if err != nil {
+			return Error{err}
+		}
+		if res != nil && m.IfExists == SkipIfExists {
+			return Complete{Result: res, Skipped: true}
+		}
+		if res != nil {
+			return Error{withClass(ErrExists, fmt.Errorf("s3://%s/%s already exists", m.Bucket, m.path))}
+		}
 	}
 
-	// Init S3 session
-	newSession := session.New(s3Config)
-	m.svc = s3.New(newSession)
+	if m.ContentHash != "" || m.SkipUnchanged {
+		if m.hash, err = m.contentHash(); err != nil {
+			return Error{err}
+		}
+	}
+	if m.SkipUnchanged && m.hash != "" {
+		if res := m.unchanged(m.hash); res != nil {
+			return Complete{Result: res, Skipped: true}
+		}
+	}
 
-	// Upload parts
+	// Upload parts. The next part is read while the current one is being
+	// sent, so two parts' worth of memory is used, unless the input can be
+	// read at an offset, like a file, in which case nothing is buffered.
 	totalBytes := 0
+	size := m.Size
+	if size == 0 {
+		size = inputSize(m.reader)
+	}
+	if size > 0 {
+		if err := m.fitParts(size); err != nil {
+			return Error{err}
+		}
+	}
+	if m.MaxBytes > 0 {
+		// When we know how big the input is we can tell right away whether
+		// it's too big. Otherwise we find out as we go, and abort.
+		if n := inputSize(m.reader); n > m.MaxBytes {
+			return Error{tooLarge(m.MaxBytes)}
+		} else if n == 0 {
+			m.reader = &sizeLimitReader{r: m.reader, max: m.MaxBytes}
+		}
+	}
+	tracker := newProgressTracker(size)
 	m.currentPartNumber = 1
-	buf := make([]byte, m.MaxPartSize)
+	var spillDir string
+	if m.SpillToDisk {
+		spillDir = m.SpillDir
+		if spillDir == "" {
+			spillDir = os.TempDir()
+		}
+	}
+	var verify *verifier
+	if m.Verify {
+		verify = newVerifier()
+	}
+	if m.SinglePutThreshold > 0 && m.svc != nil {
+		c, done, ok, err := m.smallInput(spillDir)
+		if err != nil {
+			return Error{err}
+		}
+		defer done()
+		if ok {
+			return m.sendWhole(out, tracker, c, 0, verify)
+		}
+	}
+
+	var (
+		chunks  <-chan chunk
+		release func(chunk)
+		stop    func()
+	)
+	if ra, offset, n, ok := readerAt(m.reader); ok {
+		// Files and the like are read a part at a time right from where
+		// they are, so they needn't be buffered.
+		chunks, release, stop = readAt(ra, offset, n, m.partSize)
+	} else {
+		chunks, release, stop, err = readAhead(m.reader, readAheadConfig{
+			size:     m.partSize,
+			limiter:  m.Limiter,
+			spillDir: spillDir,
+		})
+		if err != nil {
+			return Error{fmt.Errorf("could not create spill files: %v", err)}
+		}
+	}
+	defer stop()
+	waitStart := time.Now()
 	for {
+		// Stop waiting for input if we're cancelled, since it may never
+		// come.
+		var (
+			c  chunk
+			ok bool
+		)
+		select {
+		case c, ok = <-chunks:
+		case <-m.ctx.Done():
+			return m.abort(context.Cause(m.ctx))
+		}
+		if !ok {
+			break
+		}
 
-		n, err := m.reader.Read(buf)
-		if err != nil && err == io.EOF {
+		waitTime := time.Since(waitStart)
+		n, err := c.n, c.err
+		if err == io.EOF && m.res == nil && m.svc != nil {
+			// Everything fits in a single part, or there was no data at all,
+			// so send it the simple way: one request, and nothing left behind
+			// if it fails. Other backends get a single part, which may be
+			// empty.
+			return m.sendWhole(out, tracker, c, waitTime, verify)
+		}
+		if err == io.EOF && n == 0 && m.res != nil {
 			// There's no more data, so we've successfully uploaded all parts.
 			break
 		}
-		if err != nil {
-			if abortErr := m.Abort(); abortErr != nil {
-				ch <- Error{
-					Err: fmt.Errorf("upload error: %v, as well as an error aborting the upload: %v", err, abortErr),
-				}
-				return
-			}
-			ch <- Error{err}
-			return
+		if err != nil && err != io.EOF {
+			return m.abort(err)
 		}
 
 		// Request the upload if we haven't already. We wait until we've read
@@ -243,81 +916,343 @@ func (m *MultipartUpload) run(ch chan Event) {
 			input := &s3.CreateMultipartUploadInput{
 				Bucket:      aws.String(m.Bucket),
 				Key:         aws.String(m.path),
-				ContentType: aws.String(http.DetectContentType(buf[:n])),
+				ContentType: aws.String(http.DetectContentType(c.head())),
+				Metadata:    m.hashMetadata(),
+			}
+			if m.ObjectLockMode != "" {
+				input.ObjectLockMode = aws.String(m.ObjectLockMode)
+				input.ObjectLockRetainUntilDate = aws.Time(m.RetainUntil)
+			}
+			if m.LegalHold {
+				input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
 			}
+			if m.ChecksumAlgorithm.flexible() {
+				input.ChecksumAlgorithm = aws.String(string(m.ChecksumAlgorithm))
+			}
+			if m.ACL != "" {
+				input.ACL = aws.String(m.ACL)
+			}
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
 
-			m.res, err = m.svc.CreateMultipartUpload(input)
+			ctx, span := m.tracer().Start(m.ctx, "pipedream.CreateMultipartUpload")
+			res, err := m.backend.CreateUpload(ctx, input)
+			endSpan(span, err)
 			if err != nil {
-				ch <- Error{err}
-				return
+				return Error{err}
+			}
+			m.setUpload(res)
+		}
+
+		if m.currentPartNumber > MaxParts {
+			return m.abort(withClass(ErrTooManyParts, fmt.Errorf("upload needs more than %d parts; use a larger part size or PartLimitGrow", MaxParts)))
+		}
+
+		if verify != nil {
+			if err := verify.add(c.body()); err != nil {
+				return m.abort(err)
 			}
 		}
 
 		// Perform the upload
-		part, err := m.uploadPart(ch, buf[:n], m.currentPartNumber)
+		if err := m.beforePart(m.currentPartNumber, int64(n)); err != nil {
+			return m.abort(err)
+		}
+		sendStart := time.Now()
+		part, attempts, err := m.uploadPart(out, c.body(), int64(n), m.currentPartNumber)
+		networkTime := time.Since(sendStart)
+		m.afterPart(m.currentPartNumber, part, err)
 		if err != nil {
-			if abortErr := m.Abort(); abortErr != nil {
-				ch <- Error{
-					Err: fmt.Errorf("upload error: %v, as well as an error aborting the upload: %v", err, abortErr),
-				}
-				return
-			}
-			ch <- Error{err}
-			return
+			return m.abort(err)
 		}
+		release(c)
+		tracker.retries += attempts - 1
 
-		ch <- Progress{
-			PartNumber: m.currentPartNumber,
-			Bytes:      n,
+		out.send(tracker.progress(m.currentPartNumber, n, networkTime, attempts))
+		if m.ReportTimings {
+			out.send(Timing{
+				PartNumber:  m.currentPartNumber,
+				Bytes:       n,
+				ReadTime:    c.readTime,
+				WaitTime:    waitTime,
+				NetworkTime: networkTime,
+			})
 		}
 
 		totalBytes += n
 		m.completedParts = append(m.completedParts, part)
 		m.currentPartNumber++
+		waitStart = time.Now()
 	}
 
-	res, err := m.complete()
+	res, err := m.complete(int64(totalBytes))
 	if err != nil {
-		ch <- Error{err}
+		return Error{err}
+	}
+	if verify != nil {
+		if err := m.verify(verify, res.VersionId); err != nil {
+			return Error{err}
+		}
+	}
+	return Complete{
+		Bytes:   totalBytes,
+		Result:  res,
+		Summary: tracker.summary(),
+	}
+}
+
+// validate checks the settings, which should already have defaults applied.
+func (m MultipartUpload) validate() error {
+	var missing []string
+	switch {
+	case m.Backend != nil && m.Client != nil:
+		return errors.New("Client and Backend can't both be used")
+	case m.Backend != nil:
+		// Credentials are the Backend's business.
+	case m.Client != nil:
+		// And the client's.
+	case m.WebIdentityTokenFile != "":
+		if m.RoleARN == "" {
+			missing = append(missing, "RoleARN")
+		}
+	case !m.UseInstanceCredentials && m.Profile == "":
+		if m.AccessKey == "" {
+			missing = append(missing, "AccessKey")
+		}
+		if m.SecretKey == "" {
+			missing = append(missing, "SecretKey")
+		}
+	}
+	if m.Bucket == "" {
+		missing = append(missing, "Bucket")
+	}
+	if len(missing) > 0 {
+		err := errors.New("missing " + EnglishJoin(missing, true))
+		if missing[0] != "Bucket" {
+			err = withClass(ErrMissingCredentials, err)
+		}
+		return err
+	}
+	if err := m.validateAddress(); err != nil {
+		return err
+	}
+	if m.Backend != nil {
+		var needS3 []string
+		if m.CreateBucket {
+			needS3 = append(needS3, "CreateBucket")
+		}
+		if m.Preflight {
+			needS3 = append(needS3, "Preflight")
+		}
+		if m.AbortStaleAfter > 0 {
+			needS3 = append(needS3, "AbortStaleAfter")
+		}
+		if m.SkipUnchanged {
+			needS3 = append(needS3, "SkipUnchanged")
+		}
+		if m.IfExists != Overwrite {
+			needS3 = append(needS3, "IfExists")
+		}
+		if m.Verify {
+			needS3 = append(needS3, "Verify")
+		}
+		if len(m.FailoverEndpoints) > 0 {
+			needS3 = append(needS3, "FailoverEndpoints")
+		}
+		if m.ReplicateTo != nil {
+			needS3 = append(needS3, "ReplicateTo")
+		}
+		if len(needS3) > 0 {
+			return fmt.Errorf("%s can't be used with a Backend", EnglishJoin(needS3, true))
+		}
+	}
+	if err := m.validateObjectLock(); err != nil {
+		return err
+	}
+	if err := m.validateSSECustomer(); err != nil {
+		return err
+	}
+	if m.ReplicateTo != nil && (m.SSECustomerKey != "" || m.ReplicateTo.SSECustomerKey != "") {
+		return errors.New("ReplicateTo can't be used with SSECustomerKey")
+	}
+	if m.ReplicateTo != nil {
+		r := *m.ReplicateTo
+		r.ReplicateTo = nil
+		r.setDefaults()
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("bad ReplicateTo: %w", err)
+		}
+	}
+	if m.Client != nil && len(m.FailoverEndpoints) > 0 {
+		return errors.New("FailoverEndpoints can't be used with Client")
+	}
+	if m.SignatureVersion == SignatureCustom && m.SignRequest == nil && m.Client == nil && m.Backend == nil {
+		return errors.New("SignatureCustom needs SignRequest")
+	}
+	if err := m.ChecksumAlgorithm.validate(); err != nil {
+		return err
+	}
+	if m.NoContentMD5 && m.ChecksumAlgorithm == ChecksumMD5 {
+		return errors.New("NoContentMD5 can't be used with ChecksumMD5")
+	}
+	if m.NoContentMD5 && (m.ObjectLockMode != "" || m.LegalHold) && !m.ChecksumAlgorithm.flexible() {
+		return errors.New("Object Lock needs either Content-MD5 or a ChecksumAlgorithm")
+	}
+	if err := m.PartLimit.validate(); err != nil {
+		return err
+	}
+	if err := m.IfExists.validate(); err != nil {
+		return err
+	}
+	if err := m.RetryPolicy.validate(); err != nil {
+		return err
+	}
+	if m.SinglePutThreshold < 0 || m.SinglePutThreshold > maxPutSize {
+		return errors.New("the single put threshold must be between 0 and 5GB")
+	}
+	if m.MaxBytes < 0 {
+		return errors.New("the maximum size can't be negative")
+	}
+	if m.PartTimeout < 0 || m.Timeout < 0 {
+		return errors.New("timeouts can't be negative")
+	}
+	if m.AbortStaleAfter < 0 {
+		return errors.New("the age of stale uploads can't be negative")
+	}
+	if m.ACL != "" && !containsString(s3.ObjectCannedACL_Values(), m.ACL) {
+		return fmt.Errorf("unknown ACL %q; use one of %s", m.ACL, strings.Join(s3.ObjectCannedACL_Values(), ", "))
 	}
-	ch <- Complete{
-		Bytes:  totalBytes,
-		Result: res,
+	if m.ContentHash != "" {
+		if _, err := parseContentHash(m.ContentHash); err != nil {
+			return err
+		}
+	}
+	if err := m.validatePartSize(); err != nil {
+		return err
+	}
+	if m.Limiter != nil && m.MaxPartSize > m.Limiter.Max() {
+		return fmt.Errorf("part size of %d bytes is bigger than the limiter's budget of %d bytes", m.MaxPartSize, m.Limiter.Max())
 	}
+	if m.Limiter != nil && m.SinglePutThreshold > m.Limiter.Max() {
+		return fmt.Errorf("single put threshold of %d bytes is bigger than the limiter's budget of %d bytes", m.SinglePutThreshold, m.Limiter.Max())
+	}
+	return nil
 }
 
-// uploadPart performs the technical S3 stuff to upload one part of the
+// validatePartSize checks that parts will be neither too small nor too big to
+// be accepted, so it isn't found out part way through the upload.
+func (m MultipartUpload) validatePartSize() error {
+	if m.MinimumPartSize < 0 {
+		return errors.New("the minimum part size can't be negative")
+	}
+	min := m.MinimumPartSize
+	if min == 0 {
+		min = MinPartSize
+	}
+	if m.MaxPartSize < min {
+		if m.MinimumPartSize == 0 {
+			return fmt.Errorf("part size of %d bytes is smaller than the %d bytes S3 allows; set MinimumPartSize if your provider accepts smaller parts", m.MaxPartSize, MinPartSize)
+		}
+		return fmt.Errorf("part size of %d bytes is smaller than the minimum of %d bytes", m.MaxPartSize, m.MinimumPartSize)
+	}
+	if m.MaxPartSize > maxPutSize {
+		return errors.New("parts can't be bigger than 5GB")
+	}
+	return nil
+}
+
+// uploadPart uploads one part of the multipart upload, tracing it. It returns
+// the number of attempts it took.
+func (m *transfer) uploadPart(out *emitter, body io.ReadSeeker, size int64, partNum int) (*s3.CompletedPart, int, error) {
+	ctx, partSpan := m.tracer().Start(m.ctx, "pipedream.UploadPart", trace.WithAttributes(
+		attribute.Int("pipedream.part_number", partNum),
+		attribute.Int64("pipedream.part_size", size),
+	))
+	part, attempts, err := m.sendPart(ctx, out, body, size, partNum)
+	endSpan(partSpan, err)
+	return part, attempts, err
+}
+
+// sendPart performs the technical S3 stuff to upload one part of the
 // multipart upload. If it fails we'll retry based on the number set in
 // multipartUploadManager.MaxRetries.
-func (m MultipartUpload) uploadPart(ch chan Event, chunk []byte, partNum int) (*s3.CompletedPart, error) {
+func (m *transfer) sendPart(ctx context.Context, out *emitter, body io.ReadSeeker, size int64, partNum int) (*s3.CompletedPart, int, error) {
 	partInput := &s3.UploadPartInput{
-		Body:          bytes.NewReader(chunk),
 		Bucket:        m.res.Bucket,
 		Key:           m.res.Key,
 		PartNumber:    aws.Int64(int64(partNum)),
 		UploadId:      m.res.UploadId,
-		ContentLength: aws.Int64(int64(len(chunk))),
+		ContentLength: aws.Int64(size),
+	}
+	partInput.SSECustomerAlgorithm, partInput.SSECustomerKey, partInput.SSECustomerKeyMD5 = m.sseCustomer()
+
+	if m.sendMD5() {
+		sum, err := digest(body, md5.New())
+		if err != nil {
+			return nil, 0, err
+		}
+		partInput.ContentMD5 = aws.String(sum)
+	}
+
+	var sums checksums
+	if m.ChecksumAlgorithm.flexible() {
+		sum, err := m.ChecksumAlgorithm.sum(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		sums = m.ChecksumAlgorithm.fields(sum)
+		partInput.ChecksumAlgorithm = aws.String(string(m.ChecksumAlgorithm))
+		partInput.ChecksumCRC32 = sums.CRC32
+		partInput.ChecksumCRC32C = sums.CRC32C
+		partInput.ChecksumSHA1 = sums.SHA1
+		partInput.ChecksumSHA256 = sums.SHA256
 	}
 
+	// Only count what's sent, not what was read working out the checksums.
+	body, stopHeartbeat := m.startHeartbeat(out, body, size, partNum)
+	defer stopHeartbeat()
+	partInput.Body = body
+
+	start := time.Now()
 	tryNum := 1
 	for tryNum <= m.MaxRetries {
 
+		// Start from the beginning of the part. The SDK only rewinds to
+		// where the body was when the request was made, and a failed
+		// attempt may have read some or all of it.
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, tryNum, err
+		}
+
 		// Attempt to upload part
-		res, err := m.svc.UploadPart(partInput)
+		attemptCtx, span := m.tracer().Start(ctx, "pipedream.UploadPart.Attempt", trace.WithAttributes(
+			attribute.Int("pipedream.attempt", tryNum),
+		))
+		attemptCtx, cancel := m.attemptContext(attemptCtx)
+		res, err := m.backend.UploadPart(attemptCtx, partInput)
+		err = m.attemptTimedOut(ctx, attemptCtx, err, fmt.Sprintf("part %d", partNum))
+		cancel()
+		endSpan(span, err)
 		if err != nil {
 
-			// Fail
-			if tryNum == m.MaxRetries {
+			// Fail, unless there are retries left and time to use them
+			delay := m.RetryPolicy.delay(tryNum)
+			outOfTime := m.RetryPolicy.MaxElapsed > 0 && time.Since(start)+delay > m.RetryPolicy.MaxElapsed
+			if tryNum == m.MaxRetries || outOfTime {
 				if aerr, ok := err.(awserr.Error); ok {
-					return nil, aerr
+					return nil, tryNum, aerr
 				}
-				return nil, err
+				return nil, tryNum, err
 			}
 
-			ch <- Retry{
-				PartNumber:  m.currentPartNumber,
+			out.send(Retry{
+				PartNumber:  partNum,
 				RetryNumber: tryNum,
 				MaxRetries:  m.MaxRetries,
+				Delay:       delay,
+				Err:         err,
+			})
+			if err := wait(ctx, delay); err != nil {
+				return nil, tryNum, err
 			}
 
 			tryNum++
@@ -325,39 +1260,195 @@ func (m MultipartUpload) uploadPart(ch chan Event, chunk []byte, partNum int) (*
 		} else {
 			// Success
 			return &s3.CompletedPart{
-				ETag:       res.ETag,
-				PartNumber: aws.Int64(int64(partNum)),
-			}, nil
+				ETag:           res.ETag,
+				PartNumber:     aws.Int64(int64(partNum)),
+				ChecksumCRC32:  sums.CRC32,
+				ChecksumCRC32C: sums.CRC32C,
+				ChecksumSHA1:   sums.SHA1,
+				ChecksumSHA256: sums.SHA256,
+			}, tryNum, nil
 		}
 	}
 
 	// This should never happen
-	return nil, errors.New("could not upload part")
-}
-
-// complete finishes up the upload. This must be called after all parts have
-// been sent.
-func (m MultipartUpload) complete() (*s3.CompleteMultipartUploadOutput, error) {
-	return m.svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
-		Bucket:   m.res.Bucket,
-		Key:      m.res.Key,
-		UploadId: m.res.UploadId,
-		MultipartUpload: &s3.CompletedMultipartUpload{
-			Parts: m.completedParts,
-		},
-	})
-}
-
-// Abort cancels the upload.
-func (m MultipartUpload) Abort() error {
-	_, err := m.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
-		Bucket:   m.res.Bucket,
-		Key:      m.res.Key,
-		UploadId: m.res.UploadId,
-	})
+	return nil, tryNum, errors.New("could not upload part")
+}
+
+// partsPerSizeStep is how many parts are uploaded at each part size when the
+// part size is adaptive or grows with PartLimitGrow.
+const partsPerSizeStep = 1000
+
+// partSize returns the size of a given part, numbered from 1.
+func (m MultipartUpload) partSize(partNum int) int64 {
+	size := m.MaxPartSize
+	if m.AdaptivePartSize {
+		size = MinPartSize
+		for step := (partNum - 1) / partsPerSizeStep; step > 0 && size < m.MaxPartSize; step-- {
+			size *= 2
+		}
+		if size > m.MaxPartSize {
+			size = m.MaxPartSize
+		}
+	}
+	if m.PartLimit == PartLimitGrow {
+		// Grow past the configured size if need be, so that MaxParts parts
+		// add up to at least 5TB.
+		if grow := MinPartSize << ((partNum - 1) / partsPerSizeStep); grow > size {
+			size = grow
+		}
+	}
+	return size
+}
+
+// attemptContext returns the context for a single attempt at a request,
+// which is cut off after PartTimeout if it's set.
+func (m *transfer) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.PartTimeout > 0 {
+		return context.WithTimeout(ctx, m.PartTimeout)
+	}
+	return ctx, func() {}
+}
+
+// attemptTimedOut returns err, classed as ErrTimeout if it came from the
+// attempt being cut off by PartTimeout rather than ctx ending. what is what
+// the attempt was sending, for the error message.
+func (m *transfer) attemptTimedOut(ctx, attemptCtx context.Context, err error, what string) error {
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return withClass(ErrTimeout, fmt.Errorf("%s took longer than %s: %w", what, m.PartTimeout, err))
+	}
 	return err
 }
 
+// putObject uploads size bytes from body as a whole object in a single
+// request, returning the result in the same form as a completed multipart
+// upload. head is the start of the data, for detecting its content type. If
+// verify isn't nil the data is digested for it.
+func (m *transfer) putObject(body io.ReadSeeker, size int64, head []byte, verify *verifier) (*s3.CompleteMultipartUploadOutput, error) {
+	m.setState(InProgress)
+	input := &s3.PutObjectInput{
+		Body:          body,
+		Bucket:        aws.String(m.Bucket),
+		Key:           aws.String(m.path),
+		ContentType:   aws.String(http.DetectContentType(head)),
+		ContentLength: aws.Int64(size),
+		Metadata:      m.hashMetadata(),
+	}
+	if verify != nil {
+		if err := verify.addObject(body); err != nil {
+			return nil, err
+		}
+	}
+	if m.ACL != "" {
+		input.ACL = aws.String(m.ACL)
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	if m.ObjectLockMode != "" {
+		input.ObjectLockMode = aws.String(m.ObjectLockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(m.RetainUntil)
+	}
+	if m.sendMD5() {
+		sum, err := digest(body, md5.New())
+		if err != nil {
+			return nil, err
+		}
+		input.ContentMD5 = aws.String(sum)
+	}
+	if m.LegalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	if m.ChecksumAlgorithm.flexible() {
+		sum, err := m.ChecksumAlgorithm.sum(body)
+		if err != nil {
+			return nil, err
+		}
+		sums := m.ChecksumAlgorithm.fields(sum)
+		input.ChecksumAlgorithm = aws.String(string(m.ChecksumAlgorithm))
+		input.ChecksumCRC32 = sums.CRC32
+		input.ChecksumCRC32C = sums.CRC32C
+		input.ChecksumSHA1 = sums.SHA1
+		input.ChecksumSHA256 = sums.SHA256
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ctx, span := m.tracer().Start(m.ctx, "pipedream.PutObject")
+	attemptCtx, cancel := m.attemptContext(ctx)
+	res, err := m.svc.PutObjectWithContext(attemptCtx, input)
+	err = m.attemptTimedOut(ctx, attemptCtx, err, "the upload")
+	cancel()
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    input.Bucket,
+		Key:       input.Key,
+		ETag:      res.ETag,
+		VersionId: res.VersionId,
+	}, nil
+}
+
+// validateObjectLock checks that the Object Lock settings make sense
+// together.
+func (m MultipartUpload) validateObjectLock() error {
+	switch m.ObjectLockMode {
+	case "":
+		if !m.RetainUntil.IsZero() {
+			return errors.New("RetainUntil requires an ObjectLockMode")
+		}
+		return nil
+	case ObjectLockGovernance, ObjectLockCompliance:
+	default:
+		return fmt.Errorf("unknown Object Lock mode %q", m.ObjectLockMode)
+	}
+	if m.RetainUntil.IsZero() {
+		return errors.New("ObjectLockMode requires a RetainUntil date")
+	}
+	if m.RetainUntil.Before(time.Now()) {
+		return errors.New("RetainUntil must be in the future")
+	}
+	return nil
+}
+
+// abort aborts the upload after it failed with err, returning the event to end
+// the upload with.
+func (m *transfer) abort(err error) Event {
+	if m.res == nil {
+		// The upload was never created, so there's nothing to abort.
+		return Error{err}
+	}
+	if abortErr := m.abortUpload(); abortErr != nil {
+		return Error{
+			Err: fmt.Errorf("upload error: %w, as well as an error aborting the upload: %v", err, abortErr),
+		}
+	}
+	return Aborted{
+		UploadID: aws.StringValue(m.res.UploadId),
+		Reason:   err,
+	}
+}
+
+// Abort cancels the uploads in progress that were started with this
+// MultipartUpload, aborting the multipart uploads of any that have got that
+// far. Uploads that haven't are stopped before they create one, ones SendAll
+// has yet to start aren't started, and it's fine to call at any time.
+func (m *MultipartUpload) Abort() error {
+	// Stop SendAll starting any more uploads first, so none are missed.
+	for _, b := range trackedBatches(m) {
+		b.cancel(errCancelled)
+	}
+	var errs []error
+	for _, t := range tracked(m) {
+		t.cancel(errCancelled)
+		if err := t.abortUpload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // EnglishJoin joins a slice of strings with commas and the word "and" like one
 // would in English. Oxford comma optional.
 func EnglishJoin(words []string, oxfordComma bool) string {
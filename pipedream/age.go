@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+var (
+	ageRecipients []string
+	ageIdentity   string
+)
+
+// parseAgeRecipients parses age public keys, as in age1....
+func parseAgeRecipients(keys []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, len(keys))
+	for i, k := range keys {
+		r, err := age.ParseX25519Recipient(k)
+		if err != nil {
+			return nil, fmt.Errorf("bad --age-recipient %q: %v", k, err)
+		}
+		recipients[i] = r
+	}
+	return recipients, nil
+}
+
+// readAgeIdentities reads the private keys in an age identity file, such as
+// one made by age-keygen.
+func readAgeIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read identities from %s: %v", path, err)
+	}
+	return ids, nil
+}
+
+// ageEncrypt encrypts r to the given recipients as it's read. If reading r
+// fails, so does reading the result.
+func ageEncrypt(r io.Reader, recipients []age.Recipient) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := age.Encrypt(pw, recipients...)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(w, r)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// newAgeDecrypter returns a filterWriter that decrypts what's written to it
+// with age, writing the result to w.
+func newAgeDecrypter(w io.Writer, ids []age.Identity) *filterWriter {
+	return newFilterWriter(w, "could not decrypt", func(r io.Reader, w io.Writer) error {
+		dec, err := age.Decrypt(r, ids...)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, dec); err != nil {
+			return err
+		}
+		// Anything after the end of the encrypted stream means it isn't what
+		// we think it is.
+		if n, _ := io.Copy(io.Discard, r); n > 0 {
+			return fmt.Errorf("%d unexpected bytes after the end of the encrypted data", n)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/spf13/cobra"
+)
+
+var removeForce bool
+
+var mbCmd = &cobra.Command{
+	Use:   "mb [s3://BUCKET]",
+	Short: "Make a bucket",
+	Long: `Create a bucket, or space, in the region given with --region. Give the bucket
+as an argument or with --bucket. --versioning turns on versioning, and
+--object-lock-mode or --legal-hold turn on Object Lock, which can only be done
+when a bucket is created.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: mb,
+}
+
+var rbCmd = &cobra.Command{
+	Use:   "rb [s3://BUCKET]",
+	Short: "Remove a bucket",
+	Long: `Delete a bucket, or space. Give the bucket as an argument or with --bucket. It
+must be empty unless --force is given, in which case everything in it is
+deleted first, including old versions and incomplete uploads.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: rb,
+}
+
+func init() {
+	rbCmd.Flags().BoolVar(&removeForce, "force", false, "delete everything in the bucket first")
+	rootCmd.AddCommand(mbCmd, rbCmd)
+}
+
+// bucketArg sets the bucket from the argument to mb or rb, if there is one.
+func bucketArg(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(args[0], "s3://"), "/")
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("%q isn't a bucket", args[0])
+	}
+	bucket = name
+	return nil
+}
+
+func mb(cmd *cobra.Command, args []string) error {
+	if err := bucketArg(args); err != nil {
+		return err
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	if err := m.MakeBucket(); err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && (aerr.Code() == "BucketAlreadyOwnedByYou" || aerr.Code() == "BucketAlreadyExists") {
+			return fmt.Errorf("bucket %s already exists", m.Bucket)
+		}
+		return err
+	}
+	if !silent {
+		fmt.Printf("%s Made bucket %s\n", check, m.Bucket)
+	}
+	return nil
+}
+
+func rb(cmd *cobra.Command, args []string) error {
+	if err := bucketArg(args); err != nil {
+		return err
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	if err := m.RemoveBucket(removeForce); err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "BucketNotEmpty" {
+			return fmt.Errorf("bucket %s isn't empty; use --force to delete everything in it", m.Bucket)
+		}
+		return fmt.Errorf("could not remove bucket %s: %v", m.Bucket, err)
+	}
+	if !silent {
+		fmt.Printf("%s Removed bucket %s\n", check, m.Bucket)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+var catCmd = &cobra.Command{
+	Use:   "cat",
+	Short: "Write an uploaded object to stdout",
+	Long: `Stream the object at --path to stdout, the other way round from an upload,
+so it can be piped into something else:
+
+  pipedream cat -b backups -p db.sql.gz | gunzip | psql
+
+Unlike restore, nothing is checked and object sets aren't put back together.
+Uploads encrypted with --age-recipient are decrypted with --age-identity.`,
+	Args: cobra.NoArgs,
+	RunE: cat,
+}
+
+func init() {
+	catCmd.Flags().StringVar(&ageIdentity, "age-identity", "", "decrypt the object with the age private keys in this file")
+	rootCmd.AddCommand(catCmd)
+}
+
+func cat(cmd *cobra.Command, args []string) error {
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path")
+	}
+	var ids []age.Identity
+	if ageIdentity != "" {
+		if ids, err = readAgeIdentities(ageIdentity); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+
+	body, _, err := m.Get(remotePath)
+	if isNotFound(err) {
+		return fmt.Errorf("s3://%s/%s doesn't exist", m.Bucket, remotePath)
+	}
+	if err != nil {
+		return fmt.Errorf("could not download s3://%s/%s: %v", m.Bucket, remotePath, err)
+	}
+	defer body.Close()
+
+	var r io.Reader = body
+	if ids != nil {
+		if r, err = age.Decrypt(body, ids...); err != nil {
+			return fmt.Errorf("could not decrypt s3://%s/%s: %v", m.Bucket, remotePath, err)
+		}
+	}
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		return fmt.Errorf("could not download s3://%s/%s: %v", m.Bucket, remotePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+// catalogEntry is a line in the catalog, describing one successful upload.
+type catalogEntry struct {
+	Time      time.Time `json:"time"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Bytes     int64     `json:"bytes"`
+	ETag      string    `json:"etag,omitempty"`
+	Checksum  string    `json:"checksum,omitempty"`
+	VersionID string    `json:"version_id,omitempty"`
+	Duration  float64   `json:"duration_seconds"`
+}
+
+// uploadCatalog records successful uploads in a JSON lines file. A nil
+// *uploadCatalog does nothing.
+type uploadCatalog struct {
+	mtx  sync.Mutex
+	path string
+}
+
+// catalog is set unless --no-catalog is given.
+var catalog *uploadCatalog
+
+// defaultCatalogPath returns where the catalog lives unless --catalog says
+// otherwise: $XDG_DATA_HOME/pipedream/catalog.jsonl, falling back to
+// ~/.local/share.
+func defaultCatalogPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "pipedream", "catalog.jsonl")
+}
+
+// openCatalog sets up the catalog.
+func openCatalog() error {
+	if noCatalog {
+		return nil
+	}
+	if catalogPath == "" {
+		catalogPath = defaultCatalogPath()
+	}
+	if catalogPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(catalogPath), 0o755); err != nil {
+		return err
+	}
+	catalog = &uploadCatalog{path: catalogPath}
+	return nil
+}
+
+// record adds a completed upload to the catalog. Failing to write to the
+// catalog is reported but doesn't fail the upload, which already succeeded.
+func (c *uploadCatalog) record(m pipedream.MultipartUpload, key string, e pipedream.Complete) {
+	if c == nil {
+		return
+	}
+	entry := catalogEntry{
+		Time:     time.Now().UTC(),
+		Endpoint: m.Endpoint,
+		Bucket:   m.Bucket,
+		Key:      key,
+		Bytes:    e.Summary.Bytes,
+		Duration: e.Summary.Duration.Seconds(),
+	}
+	entry.ETag, entry.Checksum = uploadChecksums(e.Result)
+	if r := e.Result; r != nil {
+		entry.VersionID = aws.StringValue(r.VersionId)
+	}
+	if err := c.add(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write to catalog: %v\n", err)
+	}
+}
+
+// add writes an entry to the catalog.
+func (c *uploadCatalog) add(entry catalogEntry) error {
+	if c == nil {
+		return nil
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readCatalog returns the entries in the catalog at path, oldest first.
+func readCatalog(path string) ([]catalogEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []catalogEntry
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var e catalogEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+var (
+	historyLimit int
+	historyJSON  bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [PREFIX]",
+	Short: "List past uploads from the catalog",
+	Long: `List past uploads, most recent first, from the catalog pipedream keeps of
+every successful upload. Give a prefix to only show keys starting with it, and
+--bucket to only show one bucket.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: history,
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "show at most this many uploads; 0 shows them all")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "print entries as JSON lines")
+	rootCmd.AddCommand(historyCmd)
+}
+
+func history(cmd *cobra.Command, args []string) error {
+	path := catalogPath
+	if path == "" {
+		path = defaultCatalogPath()
+	}
+	entries, err := readCatalog(path)
+	if err != nil {
+		return err
+	}
+
+	var prefix string
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	shown := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if bucket != "" && e.Bucket != bucket {
+			continue
+		}
+		if !strings.HasPrefix(e.Key, prefix) {
+			continue
+		}
+		if historyLimit > 0 && shown == historyLimit {
+			break
+		}
+		shown++
+
+		if historyJSON {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			continue
+		}
+		details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(e.Bytes)), (time.Duration(e.Duration * float64(time.Second))).Round(time.Millisecond))
+		fmt.Printf("%s  s3://%s/%s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Bucket, e.Key, subtle(details))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp s3://BUCKET/KEY s3://BUCKET/KEY",
+	Short: "Copy an object without downloading it",
+	Long: `Copy an object to another key, in the same bucket or another one on the same
+service, without it passing through pipedream. Large objects are copied in
+parts. If the destination key is empty or ends in a slash, the source's name is
+put on the end.`,
+	Args: cobra.ExactArgs(2),
+	RunE: cp,
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+}
+
+func cp(cmd *cobra.Command, args []string) error {
+	srcBucket, srcKey, dstBucket, dstKey, err := parseCopyArgs(args)
+	if err != nil {
+		return err
+	}
+	bucket = dstBucket
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	src := fmt.Sprintf("s3://%s/%s", srcBucket, srcKey)
+	dst := fmt.Sprintf("s3://%s/%s", dstBucket, dstKey)
+	err = m.Copy(srcBucket, srcKey, dstKey)
+	if isNotFound(err) {
+		return fmt.Errorf("%s doesn't exist", src)
+	}
+	if err != nil {
+		return fmt.Errorf("could not copy %s to %s: %v", src, dst, err)
+	}
+	if !silent {
+		fmt.Printf("%s Copied %s %s %s\n", check, src, arrow, dst)
+	}
+	return nil
+}
+
+// parseCopyArgs parses the source and destination URLs given to cp and mv.
+func parseCopyArgs(args []string) (srcBucket, srcKey, dstBucket, dstKey string, err error) {
+	if srcBucket, srcKey, err = parseS3URL(args[0]); err != nil {
+		return
+	}
+	if srcKey == "" || strings.HasSuffix(srcKey, "/") {
+		err = fmt.Errorf("%q isn't an object", args[0])
+		return
+	}
+	if dstBucket, dstKey, err = parseS3URL(args[1]); err != nil {
+		return
+	}
+	if dstKey == "" || strings.HasSuffix(dstKey, "/") {
+		dstKey += path.Base(srcKey)
+	}
+	if srcBucket == dstBucket && srcKey == dstKey {
+		err = fmt.Errorf("%s can't be copied onto itself", args[0])
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dumpBin      string
+	dumpCompress string
+	dumpEncrypt  string
+)
+
+// dumpKind is a kind of database that can be dumped with db.
+type dumpKind struct {
+	bin  string
+	args []string
+	ext  string
+}
+
+var dumpKinds = map[string]dumpKind{
+	"pg":    {bin: "pg_dump", ext: ".sql"},
+	"mysql": {bin: "mysqldump", args: []string{"--single-transaction"}, ext: ".sql"},
+	"redis": {bin: "redis-cli", args: []string{"--rdb", "-"}, ext: ".rdb"},
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Dump a database and upload it",
+	Long: `Run a database's dump command, compress its output and upload it, in place of a
+pipeline of dump, gzip, encryption and upload that's easy to get wrong:
+
+  pipedream db pg -b backups -- -U app mydb
+
+Arguments after -- are passed to the dump command. If the dump fails, the
+upload is aborted. To encrypt it, use --gpg-recipient or --age-recipient, or
+--encrypt with a command of your own. Without --path the dump goes to
+KIND/{timestamp}.EXT, such as pg/20240102T030405Z.sql.gz; --path can use the
+same placeholders as schedule, and --latest copies the dump to
+KIND/latest.EXT as it does there. With --keep-daily, --keep-weekly or
+--keep-monthly dumps go to KIND/{tier}/{timestamp}.EXT and are rotated.`,
+}
+
+func init() {
+	dbCmd.PersistentFlags().StringVar(&dumpBin, "bin", "", "the dump command to run (default pg_dump, mysqldump or redis-cli)")
+	dbCmd.PersistentFlags().StringVar(&dumpCompress, "compress", "gzip", "how to compress the dump: gzip or none")
+	dbCmd.PersistentFlags().StringVar(&dumpEncrypt, "encrypt", "", "a shell command to pipe the compressed dump through to encrypt it, such as \"age -r age1...\"")
+	for _, name := range []string{"pg", "mysql", "redis"} {
+		name, kind := name, dumpKinds[name]
+		dbCmd.AddCommand(&cobra.Command{
+			Use:   name + " [-- DUMP ARGS...]",
+			Short: fmt.Sprintf("Dump with %s and upload it", strings.Join(append([]string{kind.bin}, kind.args...), " ")),
+			Args:  cobra.ArbitraryArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return dumpDatabase(cmd, name, kind, args)
+			},
+		})
+	}
+	rootCmd.AddCommand(dbCmd)
+}
+
+func dumpDatabase(cmd *cobra.Command, name string, kind dumpKind, args []string) (err error) {
+	ext := kind.ext
+	switch dumpCompress {
+	case "gzip":
+		ext += ".gz"
+	case "none":
+	default:
+		return fmt.Errorf("unknown --compress %q; use gzip or none", dumpCompress)
+	}
+	encryption, err := encryptionFlag()
+	if err != nil {
+		return err
+	}
+	if dumpEncrypt != "" && encryption != "" {
+		return fmt.Errorf("--encrypt and %s can't be used together", encryption)
+	}
+	var recipients []age.Recipient
+	if len(ageRecipients) > 0 {
+		if recipients, err = parseAgeRecipients(ageRecipients); err != nil {
+			return err
+		}
+	}
+	switch {
+	case dumpEncrypt != "":
+		ext += ".enc"
+	case len(gpgRecipients) > 0:
+		ext += ".gpg"
+	case len(recipients) > 0:
+		ext += ".age"
+	}
+
+	tmpl := remotePath
+	switch {
+	case tmpl != "":
+	case rotating():
+		tmpl = name + "/{tier}/{timestamp}" + ext
+	default:
+		tmpl = name + "/{timestamp}" + ext
+	}
+
+	// Set up notifications before anything else can go wrong, so that a
+	// misconfigured run is reported like any other failure.
+	if err := checkNotify(); err != nil {
+		return err
+	}
+	start := time.Now()
+	key := expandKey(tmpl, 1, start)
+	defer func() {
+		notify(tally.result(fmt.Sprintf("s3://%s/%s", bucket, key), key, start, err))
+	}()
+	pingStart()
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if err := checkRotation(tmpl); err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	bin := kind.bin
+	if dumpBin != "" {
+		bin = dumpBin
+	}
+	c := exec.Command(bin, append(kind.args, args...)...)
+	c.Stderr = os.Stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return fmt.Errorf("could not run %s; is it installed? Use --bin to say where it is", bin)
+		}
+		return err
+	}
+	kill := func() {
+		_ = c.Process.Kill()
+		_ = c.Wait()
+	}
+
+	var r io.Reader = &commandOutput{r: stdout, cmd: c}
+	if dumpCompress == "gzip" {
+		r = gzipStream(r)
+	}
+	if dumpEncrypt != "" {
+		var killFilter func()
+		if r, killFilter, err = filterStream(r, dumpEncrypt); err != nil {
+			kill()
+			return fmt.Errorf("could not run --encrypt command: %v", err)
+		}
+		killDump := kill
+		kill = func() {
+			killFilter()
+			killDump()
+		}
+	}
+	if len(gpgRecipients) > 0 {
+		var killGPG func()
+		if r, killGPG, err = gpgEncrypt(r, gpgRecipients); err != nil {
+			kill()
+			return err
+		}
+		killDump := kill
+		kill = func() {
+			killGPG()
+			killDump()
+		}
+	}
+	if len(recipients) > 0 {
+		r = ageEncrypt(r, recipients)
+	}
+
+	if !silent {
+		fmt.Printf("%s Dumping with %s to s3://%s/%s...\n", arrow, bin, m.Bucket, key)
+	}
+	s, err := sendReader(m, r, key)
+	if err != nil {
+		// Make sure nothing's left running, or blocked writing to a pipe
+		// nobody's reading.
+		kill()
+		return fmt.Errorf("could not upload dump: %v", err)
+	}
+	if !silent {
+		fmt.Printf("%s Done. Sent %s in %s. %s\n", check, humanize.Bytes(uint64(s.Bytes)), time.Since(start).Round(time.Millisecond), subtle(describeSummary(s.Parts, s.Retries, s.Throughput)))
+	}
+	if latest {
+		if err := pointLatest(m, tmpl, key); err != nil {
+			return err
+		}
+	}
+	if rotating() {
+		return rotate(m, tmpl)
+	}
+	return nil
+}
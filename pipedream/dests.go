@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+)
+
+// destination is one of the places stdin is sent to with --dest.
+type destination struct {
+	url    string
+	upload pipedream.MultipartUpload
+	key    string
+}
+
+// collectDestinations works out where to send stdin: the --bucket and --path
+// given, if any, followed by each --dest. All of them use the same settings
+// apart from the bucket and key.
+func collectDestinations(m pipedream.MultipartUpload, urls []string) ([]destination, error) {
+	var dests []destination
+	if m.Bucket != "" || remotePath != "" {
+		if m.Bucket == "" || remotePath == "" {
+			return nil, errors.New("--bucket and --path go together; use --dest for more destinations")
+		}
+		dests = append(dests, destination{
+			url:    fmt.Sprintf("s3://%s/%s", m.Bucket, remotePath),
+			upload: m,
+			key:    remotePath,
+		})
+	}
+	for _, u := range urls {
+		b, key, err := parseS3URL(u)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, fmt.Errorf("%q is missing a key", u)
+		}
+		d := destination{url: u, upload: m, key: key}
+		d.upload.Bucket = b
+		dests = append(dests, d)
+	}
+	return dests, nil
+}
+
+// uploadDestinations sends stdin to several destinations at once, printing a
+// line for each as it finishes and a summary at the end.
+func uploadDestinations(dests []destination, r io.Reader) error {
+	targets := make([]pipedream.Destination, len(dests))
+	for i := range dests {
+		targets[i] = pipedream.Destination{Upload: &dests[i].upload, Path: dests[i].key}
+	}
+
+	now := time.Now()
+	chans, err := pipedream.FanOut(context.Background(), r, targets...)
+	if err != nil {
+		return err
+	}
+
+	if !silent {
+		fmt.Printf("%s Uploading to %d %s...\n", arrow, len(dests), plural(len(dests), "destination", "destinations"))
+	}
+
+	var (
+		mtx    sync.Mutex
+		wg     sync.WaitGroup
+		report = summaryReport{}
+	)
+	for i, d := range dests {
+		wg.Add(1)
+		go func(d destination, ch chan pipedream.Event) {
+			defer wg.Done()
+			c, err := awaitComplete(d.upload, d.key, ch)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				report.Failed++
+				fmt.Printf("%s %s %s\n", ex, d.url, subtle(err.Error()))
+				return
+			}
+			report.add(c.Summary)
+			target := d.url
+			if public && !c.Skipped {
+				if u := objectURL(d.upload, d.key); u != "" {
+					target = u
+					if silent {
+						fmt.Println(u)
+					}
+				}
+			}
+			if !silent {
+				details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(c.Summary.Bytes)), time.Since(now).Round(time.Millisecond))
+				if c.Skipped {
+					details = skippedDetails()
+				}
+				fmt.Printf("%s %s %s\n", check, target, subtle(details))
+			}
+		}(d, chans[i])
+	}
+	wg.Wait()
+
+	report.finish(time.Since(now))
+	if report.Failed > 0 {
+		err = fmt.Errorf("%d of %d destinations failed", report.Failed, len(dests))
+		report.Error = err.Error()
+	}
+	if jsonSummary() {
+		report.print()
+	} else if err == nil && !silent {
+		fmt.Printf("%s Done. Sent to %d %s in %s. %s\n", check, len(dests), plural(len(dests), "destination", "destinations"), time.Since(now).Round(time.Millisecond), subtle(describeSummary(report.Parts, report.Retries, report.Throughput)))
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var duJSON bool
+
+var duCmd = &cobra.Command{
+	Use:   "du [PREFIX]",
+	Short: "Show how much space objects take up",
+	Long: `Add up the sizes of the objects in the bucket whose keys start with PREFIX,
+or of everything in the bucket, broken down by the next level of the key down,
+up to the next slash.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: du,
+}
+
+func init() {
+	duCmd.Flags().BoolVar(&duJSON, "json", false, "print the totals as JSON")
+	rootCmd.AddCommand(duCmd)
+}
+
+// duTotal is the space taken up by a group of objects.
+type duTotal struct {
+	Prefix  string `json:"prefix"`
+	Objects int    `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func du(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		remotePath = args[0]
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	objects, err := m.List(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not list objects: %v", err)
+	}
+
+	total := duTotal{Prefix: remotePath}
+	groups := map[string]*duTotal{}
+	for _, o := range objects {
+		group := o.Key
+		if i := strings.Index(o.Key[len(remotePath):], "/"); i >= 0 {
+			group = o.Key[:len(remotePath)+i+1]
+		}
+		g, ok := groups[group]
+		if !ok {
+			g = &duTotal{Prefix: group}
+			groups[group] = g
+		}
+		g.Objects++
+		g.Bytes += o.Size
+		total.Objects++
+		total.Bytes += o.Size
+	}
+
+	sorted := make([]duTotal, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, *g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Prefix < sorted[j].Prefix
+	})
+
+	if duJSON {
+		b, err := json.Marshal(struct {
+			duTotal
+			Breakdown []duTotal `json:"breakdown"`
+		}{total, sorted})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	row := func(t duTotal, name string) {
+		fmt.Printf("%10s  %s  %s\n", humanize.Bytes(uint64(t.Bytes)), name, subtle(fmt.Sprintf("%d %s", t.Objects, plural(t.Objects, "object", "objects"))))
+	}
+	for _, g := range sorted {
+		row(g, g.Prefix)
+	}
+	row(total, "total")
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix can be put in front of any of the environment variables we read,
+// such as PIPEDREAM_ACCESS_KEY, to keep them apart from other tools'. The
+// prefixed ones take precedence.
+const envPrefix = "PIPEDREAM_"
+
+// envAliases are the standard AWS names for some of our environment
+// variables, used when ours aren't set.
+var envAliases = map[string]string{
+	"ACCESS_KEY":    "AWS_ACCESS_KEY_ID",
+	"SECRET_KEY":    "AWS_SECRET_ACCESS_KEY",
+	"SESSION_TOKEN": "AWS_SESSION_TOKEN",
+}
+
+// loadEnv sets up the environment before any of it is read: variables from
+// envFile, if given, then prefixed variables and aliases. Variables already in
+// the environment win over the ones in the file.
+func loadEnv(envFile string) error {
+	if envFile != "" {
+		if err := loadEnvFile(envFile); err != nil {
+			return err
+		}
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if name := strings.TrimPrefix(k, envPrefix); name != k && name != "" {
+			os.Setenv(name, v)
+		}
+	}
+	for name, alias := range envAliases {
+		if os.Getenv(name) != "" {
+			continue
+		}
+		if v := os.Getenv(alias); v != "" {
+			os.Setenv(name, v)
+		}
+	}
+	return nil
+}
+
+// loadEnvFile reads KEY=VALUE lines from a .env file into the environment.
+// Blank lines, comments and a leading "export" are allowed, and values may be
+// quoted.
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read env file: %v", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		if _, set := os.LookupEnv(k); !set {
+			os.Setenv(k, v)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("could not read env file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// eventLog writes upload events as newline-delimited JSON, one object per
+// line, for wrapper scripts to follow. A nil *eventLog does nothing.
+type eventLog struct {
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+// events is set when --events-fd or --events-file is given.
+var events *eventLog
+
+// openEventLog sets up the event log on a file descriptor or, if fd is zero,
+// a file, which is appended to.
+func openEventLog(fd int, path string) error {
+	var w io.Writer
+	switch {
+	case fd > 0:
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if f == nil {
+			return fmt.Errorf("bad file descriptor %d", fd)
+		}
+		w = f
+	case path != "":
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		w = f
+	default:
+		return nil
+	}
+	events = &eventLog{enc: json.NewEncoder(w)}
+	return nil
+}
+
+// write records an event for the upload to key. Write errors are dropped so a
+// reader going away doesn't stop the upload.
+func (l *eventLog) write(key string, e pipedream.Event) {
+	if l == nil {
+		return
+	}
+	obj := eventJSON(e)
+	if obj == nil {
+		return
+	}
+	obj["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	obj["key"] = key
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	_ = l.enc.Encode(obj)
+}
+
+// eventJSON returns the fields of an event as a JSON object. Durations are in
+// seconds.
+func eventJSON(e pipedream.Event) map[string]interface{} {
+	switch e := e.(type) {
+	case pipedream.Progress:
+		obj := map[string]interface{}{
+			"type":             "progress",
+			"part":             e.PartNumber,
+			"bytes":            e.Bytes,
+			"parts":            e.Parts,
+			"duration_seconds": e.Duration.Seconds(),
+			"attempts":         e.Attempts,
+			"sent":             e.Sent,
+			"elapsed_seconds":  e.Elapsed.Seconds(),
+			"rate":             e.Rate,
+		}
+		if e.Size > 0 {
+			obj["size"] = e.Size
+			obj["percent"] = e.Percent
+			obj["eta_seconds"] = e.ETA.Seconds()
+		}
+		return obj
+	case pipedream.Timing:
+		return map[string]interface{}{
+			"type":            "timing",
+			"part":            e.PartNumber,
+			"bytes":           e.Bytes,
+			"read_seconds":    e.ReadTime.Seconds(),
+			"wait_seconds":    e.WaitTime.Seconds(),
+			"network_seconds": e.NetworkTime.Seconds(),
+		}
+	case pipedream.Heartbeat:
+		return map[string]interface{}{
+			"type":            "heartbeat",
+			"part":            e.PartNumber,
+			"in_flight":       e.InFlight,
+			"part_size":       e.PartSize,
+			"elapsed_seconds": e.Elapsed.Seconds(),
+		}
+	case pipedream.Retry:
+		return map[string]interface{}{
+			"type":          "retry",
+			"part":          e.PartNumber,
+			"retry":         e.RetryNumber,
+			"max_retries":   e.MaxRetries,
+			"delay_seconds": e.Delay.Seconds(),
+			"error":         errString(e.Err),
+		}
+	case pipedream.Replicated:
+		obj := map[string]interface{}{
+			"type":   "replicated",
+			"bucket": e.Bucket,
+			"key":    e.Key,
+		}
+		if e.Err != nil {
+			obj["error"] = e.Err.Error()
+		}
+		return obj
+	case pipedream.Failover:
+		return map[string]interface{}{
+			"type":  "failover",
+			"from":  e.From,
+			"to":    e.To,
+			"error": errString(e.Err),
+		}
+	case pipedream.Complete:
+		obj := map[string]interface{}{
+			"type":  "complete",
+			"bytes": e.Bytes,
+		}
+		if e.Result != nil {
+			if e.Result.Location != nil {
+				obj["location"] = *e.Result.Location
+			}
+			if e.Result.ETag != nil {
+				obj["etag"] = *e.Result.ETag
+			}
+			if e.Result.VersionId != nil {
+				obj["version_id"] = *e.Result.VersionId
+			}
+		}
+		return obj
+	case pipedream.Aborted:
+		return map[string]interface{}{
+			"type":      "aborted",
+			"upload_id": e.UploadID,
+			"error":     errString(e.Reason),
+		}
+	case pipedream.Error:
+		return map[string]interface{}{
+			"type":  "error",
+			"error": errString(e.Err),
+		}
+	}
+	return nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
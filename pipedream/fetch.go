@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch URL",
+	Short: "Upload a file straight from an HTTP(S) URL",
+	Long: `Download URL and upload it as it arrives, without touching the disk:
+
+  pipedream fetch https://example.com/big.iso -b isos -p big.iso
+
+If --path is missing the last part of the URL's path is used. If the download
+breaks off it's picked up where it left off with a Range request, as long as
+the server supports them and the file hasn't changed in the meantime.`,
+	Args: cobra.ExactArgs(1),
+	RunE: fetch,
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd)
+}
+
+func fetch(cmd *cobra.Command, args []string) error {
+	src, err := url.Parse(args[0])
+	if err != nil || (src.Scheme != "http" && src.Scheme != "https") {
+		return fmt.Errorf("%q isn't an HTTP(S) URL", args[0])
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	key := remotePath
+	if key == "" {
+		key = path.Base(src.Path)
+		if key == "/" || key == "." {
+			return errors.New("missing path, and the URL doesn't have a file name to use")
+		}
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	body, err := openURL(src.String(), maxRetries)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if body.size > 0 {
+		m.Size = body.size
+	}
+
+	if !silent {
+		fmt.Printf("%s Fetching %s...\n", arrow, src)
+	}
+	now := time.Now()
+	c, err := sendComplete(m, body, key)
+	if err != nil {
+		return fmt.Errorf("could not upload %s: %v", src, err)
+	}
+	if !silent {
+		s := c.Summary
+		fmt.Printf("%s Done. Sent %s to s3://%s/%s in %s. %s\n", check, humanize.Bytes(uint64(s.Bytes)), m.Bucket, key, time.Since(now).Round(time.Millisecond), subtle(describeSummary(s.Parts, s.Retries, s.Throughput)))
+	}
+	return nil
+}
+
+// urlReader reads the body of a URL, picking up where it left off with a
+// Range request if the connection breaks.
+type urlReader struct {
+	url     string
+	body    io.ReadCloser
+	size    int64 // from Content-Length; 0 if unknown
+	read    int64
+	retries int
+
+	// validator identifies the version of the file, so we only resume
+	// reading the same one.
+	validator string
+}
+
+// openURL starts downloading a URL, allowing it to be resumed up to retries
+// times.
+func openURL(u string, retries int) (*urlReader, error) {
+	res, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("could not fetch %s: %s", u, res.Status)
+	}
+	r := &urlReader{
+		url:       u,
+		body:      res.Body,
+		size:      res.ContentLength,
+		retries:   retries,
+		validator: res.Header.Get("ETag"),
+	}
+	if r.size < 0 {
+		r.size = 0
+	}
+	if r.validator == "" {
+		r.validator = res.Header.Get("Last-Modified")
+	}
+	if res.Header.Get("Accept-Ranges") != "bytes" {
+		// Resuming would mean starting over.
+		r.retries = 0
+	}
+	return r, nil
+}
+
+func (r *urlReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.read += int64(n)
+	if err == io.EOF && r.size > 0 && r.read < r.size {
+		// The connection was closed early.
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if r.retries > 0 {
+		resumeErr := r.resume()
+		if resumeErr == nil {
+			return n, nil
+		}
+		err = fmt.Errorf("%v, and could not resume: %v", err, resumeErr)
+	}
+	// Wrapped, so a short read isn't mistaken for the end of the input.
+	return n, fmt.Errorf("download broke off after %d bytes: %w", r.read, err)
+}
+
+// resume requests the rest of the file after a broken connection.
+func (r *urlReader) resume() error {
+	r.retries--
+	r.body.Close()
+	if !silent {
+		fmt.Printf("%s Download interrupted; resuming from %s\n", arrow, humanize.Bytes(uint64(r.read)))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.read))
+	if r.validator != "" {
+		req.Header.Set("If-Range", r.validator)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		// A 200 means the file changed, or ranges aren't supported after
+		// all, so we'd be starting over.
+		res.Body.Close()
+		return fmt.Errorf("server responded %s", res.Status)
+	}
+	r.body = res.Body
+	return nil
+}
+
+func (r *urlReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+)
+
+// localFile is a file on disk and the key we'll upload it to.
+type localFile struct {
+	path    string
+	key     string
+	size    int64
+	modTime time.Time
+}
+
+// collectFiles expands the given paths, walking any directories, into a list
+// of files to upload under prefix. Directories keep their name in the key, so
+// uploading "logs" puts "logs/app.log" at "prefix/logs/app.log". If a single
+// file is given and prefix doesn't end in a slash, prefix is used as its key.
+func collectFiles(paths []string, prefix string) ([]localFile, error) {
+	var files []localFile
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, localFile{
+				path:    p,
+				key:     joinKey(prefix, filepath.Base(p)),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+			continue
+		}
+
+		root := filepath.Clean(p)
+		parent := filepath.Dir(root)
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(parent, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, localFile{
+				path:    p,
+				key:     joinKey(prefix, filepath.ToSlash(rel)),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(paths) == 1 && len(files) == 1 && prefix != "" && !strings.HasSuffix(prefix, "/") {
+		if info, err := os.Stat(paths[0]); err == nil && !info.IsDir() {
+			files[0].key = prefix
+		}
+	}
+
+	return files, nil
+}
+
+// joinKey joins a key prefix and a name.
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return path.Join(prefix, name)
+}
+
+// uploadFiles uploads files, several at once, printing a line for each file as
+// it finishes and a summary at the end.
+func uploadFiles(m pipedream.MultipartUpload, files []localFile) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no files to upload")
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		mtx       sync.Mutex
+		wg        sync.WaitGroup
+		report    = summaryReport{Files: len(files)}
+		now       = time.Now()
+		queue     = make(chan localFile)
+		printLine = func(format string, a ...interface{}) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			fmt.Printf(format, a...)
+		}
+	)
+
+	if !silent {
+		fmt.Printf("%s Uploading %d files, %d at a time...\n", arrow, len(files), jobs)
+	}
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range queue {
+				start := time.Now()
+				c, err := uploadFile(m, f)
+				s := c.Summary
+
+				mtx.Lock()
+				if err != nil {
+					report.Failed++
+				} else {
+					report.add(s)
+				}
+				mtx.Unlock()
+
+				if err != nil {
+					printLine("%s %s %s\n", ex, f.path, subtle(err.Error()))
+					continue
+				}
+				target := f.key
+				if public && !c.Skipped {
+					if u := objectURL(m, f.key); u != "" {
+						target = u
+						if silent {
+							printLine("%s\n", u)
+						}
+					}
+				}
+				if !silent {
+					details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(s.Bytes)), time.Since(start).Round(time.Millisecond))
+					if c.Skipped {
+						details = skippedDetails()
+					}
+					printLine("%s %s %s %s %s\n", check, f.path, arrow, target, subtle(details))
+				}
+			}
+		}()
+	}
+
+	for _, f := range files {
+		queue <- f
+	}
+	close(queue)
+	wg.Wait()
+
+	report.finish(time.Since(now))
+	var err error
+	if report.Failed > 0 {
+		err = fmt.Errorf("%d of %d files failed to upload", report.Failed, len(files))
+		report.Error = err.Error()
+	}
+	if jsonSummary() {
+		report.print()
+	} else if err == nil && !silent {
+		fmt.Printf("%s Done. Sent %d files, %s, in %s. %s\n", check, len(files), humanize.Bytes(uint64(report.Bytes)), time.Since(now).Round(time.Millisecond), subtle(describeSummary(report.Parts, report.Retries, report.Throughput)))
+	}
+	return err
+}
+
+// uploadFile uploads a single file.
+func uploadFile(m pipedream.MultipartUpload, f localFile) (pipedream.Complete, error) {
+	r, err := os.Open(f.path)
+	if err != nil {
+		return pipedream.Complete{}, err
+	}
+	defer r.Close()
+	return sendComplete(m, r, f.key)
+}
+
+// sendReader uploads everything in r to key, reporting events to any metrics,
+// stats or event log, and returns the upload's summary.
+func sendReader(m pipedream.MultipartUpload, r io.Reader, key string) (pipedream.Summary, error) {
+	c, err := sendComplete(m, r, key)
+	return c.Summary, err
+}
+
+// sendComplete is like sendReader, but returns the whole Complete event.
+func sendComplete(m pipedream.MultipartUpload, r io.Reader, key string) (pipedream.Complete, error) {
+	ch, err := m.Start(r, key)
+	if err != nil {
+		return pipedream.Complete{}, err
+	}
+	return awaitComplete(m, key, ch)
+}
+
+// awaitComplete reports the events from an upload that's been started to any
+// metrics, stats or event log, and returns its Complete event.
+func awaitComplete(m pipedream.MultipartUpload, key string, ch chan pipedream.Event) (pipedream.Complete, error) {
+	metrics.started()
+	stats.started()
+	for e := range ch {
+		metrics.observe(e)
+		stats.observe(e)
+		tally.observe(e)
+		events.write(key, e)
+		switch e := e.(type) {
+		case pipedream.Replicated:
+			printReplicated(e)
+		case pipedream.Error:
+			return pipedream.Complete{}, e
+		case pipedream.Aborted:
+			return pipedream.Complete{}, e
+		case pipedream.Complete:
+			if !e.Skipped {
+				catalog.record(m, key, e)
+			}
+			return e, nil
+		}
+	}
+	return pipedream.Complete{}, fmt.Errorf("upload of %s ended unexpectedly", key)
+}
+
+// spool copies r to a temporary file, in --spill-dir if given, and returns the
+// file rewound to the start. The caller should remove it when done.
+func spool(r io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp(spillDir, "pipedream-spool-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/meowgorithm/babyenv"
+	"github.com/meowgorithm/pipedream"
+)
+
+// parseFromURL splits the URL given to --from into an endpoint, which may be
+// empty, a bucket and a key. The endpoint is only looked for when withEndpoint
+// is set, and is told apart from a bucket by having a dot or a port in it and
+// being followed by both a bucket and a key.
+func parseFromURL(s string, withEndpoint bool) (endpoint, bucket, key string, err error) {
+	bucket, key, err = parseS3URL(s)
+	if err != nil {
+		return "", "", "", err
+	}
+	if withEndpoint && strings.ContainsAny(bucket, ".:") {
+		if b, k, ok := strings.Cut(key, "/"); ok && b != "" && k != "" {
+			endpoint, bucket, key = bucket, b, k
+		}
+	}
+	if key == "" {
+		return "", "", "", fmt.Errorf("%q is missing a key", s)
+	}
+	return endpoint, bucket, key, nil
+}
+
+// openSource starts downloading the object given with --from, using the
+// destination's settings apart from anything given for the source, as with
+// mirror. It returns the object's body and size. An endpoint in the URL is
+// only recognized when one isn't given with --source-endpoint or
+// SOURCE_ENDPOINT, so buckets with dots in their names can still be read.
+func openSource(dst pipedream.MultipartUpload, from string) (io.ReadCloser, int64, error) {
+	var cfg sourceConfig
+	if err := babyenv.Parse(&cfg); err != nil {
+		return nil, 0, fmt.Errorf("Could not parse config: %v", err)
+	}
+	endpoint, bucket, key, err := parseFromURL(from, sourceEndpoint == "" && cfg.Endpoint == "")
+	if err != nil {
+		return nil, 0, err
+	}
+	src, _ := sourceUpload(dst, cfg)
+	src.Bucket = bucket
+	if endpoint != "" {
+		src.Endpoint = endpoint
+	}
+
+	body, info, err := src.Get(key)
+	if isNotFound(err) {
+		return nil, 0, fmt.Errorf("%s doesn't exist", from)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not download %s: %v", from, err)
+	}
+	return body, info.Size, nil
+}
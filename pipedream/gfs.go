@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+var (
+	keepDaily   int
+	keepWeekly  int
+	keepMonthly int
+)
+
+// The tiers of a grandfather-father-son rotation, from the youngest.
+var gfsTiers = []string{"daily", "weekly", "monthly"}
+
+// gfsTier returns the tier an upload made at t belongs to: monthly on the
+// first of the month, weekly on Sundays and daily otherwise, in UTC.
+func gfsTier(t time.Time) string {
+	t = t.UTC()
+	switch {
+	case t.Day() == 1:
+		return "monthly"
+	case t.Weekday() == time.Sunday:
+		return "weekly"
+	}
+	return "daily"
+}
+
+// gfsKeep returns how many uploads to keep in a tier, or 0 to keep them all.
+func gfsKeep(tier string) int {
+	switch tier {
+	case "daily":
+		return keepDaily
+	case "weekly":
+		return keepWeekly
+	case "monthly":
+		return keepMonthly
+	}
+	return 0
+}
+
+// rotating reports whether uploads are being rotated.
+func rotating() bool {
+	return keepDaily > 0 || keepWeekly > 0 || keepMonthly > 0
+}
+
+// checkRotation makes sure a key template can be rotated: it has to put each
+// tier somewhere of its own, and tell the uploads in a tier apart.
+func checkRotation(tmpl string) error {
+	if keepDaily < 0 || keepWeekly < 0 || keepMonthly < 0 {
+		return errors.New("--keep-daily, --keep-weekly and --keep-monthly can't be negative")
+	}
+	if !rotating() {
+		return nil
+	}
+	before, after, ok := strings.Cut(tmpl, "{tier}")
+	switch {
+	case !ok:
+		return errors.New("rotating uploads needs a --path with {tier} in it, such as db/{tier}/{timestamp}.sql.gz")
+	case strings.Contains(before, "{"):
+		return errors.New("{tier} has to come before any other placeholders in --path when rotating uploads")
+	case !strings.Contains(after, "{"):
+		return errors.New("rotating uploads needs a --path with a placeholder such as {timestamp} after {tier}, or there'd be nothing to tell the uploads in a tier apart")
+	}
+	return nil
+}
+
+// tierPrefix returns the template with {tier} filled in, up to the first
+// placeholder after it. Every upload in the tier has a key starting with it.
+func tierPrefix(tmpl, tier string) string {
+	before, after, _ := strings.Cut(tmpl, "{tier}")
+	if i := strings.Index(after, "{"); i >= 0 {
+		after = after[:i]
+	}
+	return before + tier + after
+}
+
+// rotate deletes the oldest uploads in each tier of the rotation beyond the
+// number to keep. Tiers with nothing to keep set are left alone.
+func rotate(m pipedream.MultipartUpload, tmpl string) error {
+	for _, tier := range gfsTiers {
+		keep := gfsKeep(tier)
+		if keep == 0 {
+			continue
+		}
+		backups, err := listBackups(m, tierPrefix(tmpl, tier))
+		if err != nil {
+			return err
+		}
+		if len(backups) <= keep {
+			continue
+		}
+		if err := deleteBackups(m, backups[keep:], len(backups), tier); err != nil {
+			return fmt.Errorf("could not rotate %s uploads: %v", tier, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// expandKey fills in the placeholders in a key template:
+//
+//	{n}          the number of the upload, starting at 1
+//	{timestamp}  the UTC time, as 20060102T150405Z
+//	{date}       the UTC date, as 2006-01-02
+//	{unix}       seconds since the Unix epoch
+//	{tier}       daily, weekly or monthly, for rotating uploads
+func expandKey(tmpl string, n int, t time.Time) string {
+	t = t.UTC()
+	return strings.NewReplacer(
+		"{n}", strconv.Itoa(n),
+		"{timestamp}", t.Format("20060102T150405Z"),
+		"{date}", t.Format("2006-01-02"),
+		"{unix}", strconv.FormatInt(t.Unix(), 10),
+		"{tier}", gfsTier(t),
+	).Replace(tmpl)
+}
+
+// latestKey returns the key that uploads to a key template are copied to with
+// --latest: the template with each placeholder replaced by "latest", so
+// db/{timestamp}.sql.gz gives db/latest.sql.gz.
+func latestKey(tmpl string) (string, error) {
+	key := strings.NewReplacer(
+		"{n}", "latest",
+		"{timestamp}", "latest",
+		"{date}", "latest",
+		"{unix}", "latest",
+		"{tier}", "latest",
+	).Replace(tmpl)
+	if key == tmpl {
+		return "", errors.New("--latest needs a --path with a placeholder such as {timestamp}, or there'd be nothing to tell the uploads apart")
+	}
+	return key, nil
+}
+
+// pointLatest copies what was just uploaded to key, from the template tmpl,
+// to the template's latest key, so there's always a stable key to fetch the
+// newest upload from.
+func pointLatest(m pipedream.MultipartUpload, tmpl, key string) error {
+	latest, err := latestKey(tmpl)
+	if err != nil {
+		return err
+	}
+	if err := m.Copy(m.Bucket, key, latest); err != nil {
+		return fmt.Errorf("could not copy to %s: %v", latest, err)
+	}
+	if !silent {
+		fmt.Printf("%s Copied to s3://%s/%s\n", check, m.Bucket, latest)
+	}
+	return nil
+}
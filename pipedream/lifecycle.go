@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var abortDays int
+
+var lifecycleCmd = &cobra.Command{
+	Use:   "lifecycle",
+	Short: "Manage a bucket's lifecycle rules",
+}
+
+var ensureAbortCmd = &cobra.Command{
+	Use:   "ensure-abort-incomplete [s3://BUCKET]",
+	Short: "Have the bucket abort incomplete uploads after a while",
+	Long: `Add a lifecycle rule to the bucket, given as an argument or with --bucket, that
+aborts incomplete multipart uploads --days after they were started, so the
+parts of uploads that never finished, such as when a run crashed, aren't
+charged for forever:
+
+  pipedream lifecycle ensure-abort-incomplete --days 3 -b backups
+
+The bucket's other rules are kept, and if one already aborts incomplete
+uploads across the whole bucket as soon or sooner nothing is changed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: ensureAbortIncomplete,
+}
+
+func init() {
+	ensureAbortCmd.Flags().IntVar(&abortDays, "days", 7, "how many days after they were started to abort incomplete uploads")
+	lifecycleCmd.AddCommand(ensureAbortCmd)
+	rootCmd.AddCommand(lifecycleCmd)
+}
+
+func ensureAbortIncomplete(cmd *cobra.Command, args []string) error {
+	if err := bucketArg(args); err != nil {
+		return err
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	changed, err := m.EnsureAbortIncomplete(abortDays)
+	if err != nil {
+		return err
+	}
+	if silent {
+		return nil
+	}
+	if changed {
+		fmt.Printf("%s Bucket %s now aborts incomplete uploads after %d %s\n", check, m.Bucket, abortDays, plural(abortDays, "day", "days"))
+	} else {
+		fmt.Printf("%s Bucket %s already aborts incomplete uploads within %d %s\n", check, m.Bucket, abortDays, plural(abortDays, "day", "days"))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var listenCmd = &cobra.Command{
+	Use:   "listen FIFO",
+	Short: "Upload whatever is written to a named pipe",
+	Long: `Create a named pipe, if it doesn't already exist, and upload everything
+written to it, starting a new upload each time a writer connects. Once the
+last writer closes the pipe the upload is completed. Any program that can
+write to a file can then send to the bucket:
+
+  pipedream listen /var/run/backup.fifo -b backups -p 'db/{timestamp}.sql'
+  pg_dump mydb > /var/run/backup.fifo
+
+The path can contain placeholders so each upload gets its own key: {n} is the
+number of the upload, {timestamp} is the time as 20060102T150405Z, {date} is
+the date as 2006-01-02, {unix} is seconds since the epoch and {tier} is
+daily, weekly or monthly, for rotating uploads as with schedule. Without any,
+each upload replaces the last.`,
+	Args: cobra.ExactArgs(1),
+	RunE: listen,
+}
+
+func init() {
+	rootCmd.AddCommand(listenCmd)
+}
+
+func listen(cmd *cobra.Command, args []string) error {
+	fifo := args[0]
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path")
+	}
+	if latest {
+		if _, err := latestKey(remotePath); err != nil {
+			return err
+		}
+	}
+	if err := checkRotation(remotePath); err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	if err := makeFIFO(fifo); err != nil {
+		return err
+	}
+	if !silent {
+		fmt.Printf("%s Listening on %s...\n", arrow, fifo)
+	}
+
+	for n := 1; ; {
+		// Blocks until a writer connects.
+		f, err := os.Open(fifo)
+		if err != nil {
+			return err
+		}
+
+		// Writers that connect and leave without writing anything don't get
+		// an upload.
+		r := bufio.NewReader(f)
+		if _, err := r.Peek(1); err == io.EOF {
+			f.Close()
+			continue
+		}
+
+		key := expandKey(remotePath, n, time.Now())
+		start := time.Now()
+		pingStart()
+		c, err := sendComplete(m, r, key)
+		f.Close()
+		n++
+		notify(uploadResult(m, key, start, c, err))
+
+		if err != nil {
+			fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+			continue
+		}
+		if !silent {
+			details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(c.Summary.Bytes)), time.Since(start).Round(time.Millisecond))
+			fmt.Printf("%s %s %s\n", check, key, subtle(details))
+		}
+		if latest {
+			if err := pointLatest(m, remotePath, key); err != nil {
+				fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+			}
+		}
+		if rotating() {
+			if err := rotate(m, remotePath); err != nil {
+				fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+			}
+		}
+	}
+}
+
+// makeFIFO creates a named pipe at path, unless there's one there already.
+func makeFIFO(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and isn't a named pipe", path)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		return fmt.Errorf("could not create named pipe: %v", err)
+	}
+	return nil
+}
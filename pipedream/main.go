@@ -3,10 +3,13 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/dustin/go-humanize"
 	"github.com/meowgorithm/babyenv"
 	"github.com/meowgorithm/pipedream"
@@ -32,153 +35,916 @@ var (
 	subtle = termenv.Style{}.Foreground(color("240")).Styled
 	arrow  = subtle(">")
 
+	// teeOut is where input is copied to with --tee.
+	teeOut io.Writer
+
+	// expectedBytes is the expected size of piped input, in bytes.
+	expectedBytes int64
+
 	// Flags
 	endpoint    string
+	failover    []string
 	region      string
 	bucket      string
 	remotePath  string
 	maxRetries  int
 	maxPartSize int
+	minPartSize int
 	silent      bool
 	showVersion bool
+
+	roleARN         string
+	externalID      string
+	roleSessionName string
+	roleDuration    time.Duration
+
+	instanceCredentials bool
+	awsProfile          string
+	sessionToken        string
+	signatureVersion    string
+
+	objectLockMode string
+	retainUntil    string
+	legalHold      bool
+
+	createBucket  bool
+	versioning    bool
+	preflight     bool
+	abortStale    time.Duration
+	adaptive      bool
+	timings       bool
+	jobs          int
+	spillDir      string
+	metricsAddr   string
+	statsdAddr    string
+	statsdPrefix  string
+	eventsFD      int
+	eventsFile    string
+	debug         bool
+	summaryFormat string
+	heartbeat     time.Duration
+	catalogPath   string
+	noCatalog     bool
+	verify        bool
+	splitSize     string
+	partLimit     string
+	singlePut     string
+	maxBytes      string
+	expectedSize  string
+	skipUnchanged bool
+	contentHash   string
+	ifNotExists   string
+	public        bool
+	checksumAlgo  string
+	noContentMD5  bool
+	useTUI        bool
+	tee           bool
+	destURLs      []string
+	fromURL       string
+	gpgRecipients []string
+	latest        bool
+
+	retryBackoff    time.Duration
+	retryMultiplier float64
+	retryMaxDelay   time.Duration
+	retryMaxElapsed time.Duration
+	partTimeout     time.Duration
+	timeout         time.Duration
+
+	maxIdleConns     int
+	idleTimeout      time.Duration
+	noExpectContinue bool
+	noHTTP2          bool
+
+	envFile string
 )
 
 type config struct {
-	AccessKey string `env:"ACCESS_KEY,required"`
-	SecretKey string `env:"SECRET_KEY,required"`
-	Endpoint  string `env:"ENDPOINT" default:"s3.amazonaws.com"`
-	Region    string `env:"REGION" default:"us-east-1"`
+	AccessKey string `env:"ACCESS_KEY"`
+	SecretKey string `env:"SECRET_KEY"`
+	Token     string `env:"SESSION_TOKEN"`
+	Endpoint  string `env:"ENDPOINT"`
+	Region    string `env:"REGION"`
+	Profile   string `env:"AWS_PROFILE"`
+
+	// How big piped input will be, if known
+	ExpectedSize string `env:"EXPECTED_SIZE"`
+
+	// Set by EKS when using IAM roles for service accounts
+	WebIdentityTokenFile string `env:"AWS_WEB_IDENTITY_TOKEN_FILE"`
+	RoleARN              string `env:"AWS_ROLE_ARN"`
+	RoleSessionName      string `env:"AWS_ROLE_SESSION_NAME"`
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "pipedream [flags] < INPUT\n  INPUT | pipedream [flags]",
+	Use:   "pipedream [flags] < INPUT\n  INPUT | pipedream [flags]\n  pipedream [flags] FILE|DIR...",
 	Short: "An S3 multipart uploader",
 	Long:  info(),
-	Args:  cobra.NoArgs,
-	RunE:  run,
+	Args:  cobra.ArbitraryArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadEnv(envFile)
+	},
+	RunE: run,
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&endpoint, "endpoint", "e", "", "the endpoint to upload to (default \"s3.amazonaws.com\")")
+	rootCmd.PersistentFlags().StringVar(&replicateTo, "replicate-to", "", "once uploaded, have the object copied to this s3://bucket, such as one in another region")
+	rootCmd.PersistentFlags().StringVar(&replicaEndpoint, "replica-endpoint", "", "the endpoint of the --replicate-to bucket, if it's not the same")
+	rootCmd.PersistentFlags().StringVar(&replicaRegion, "replica-region", "", "the region of the --replicate-to bucket, if it's not the same")
+	rootCmd.PersistentFlags().StringArrayVar(&failover, "failover-endpoint", nil, "an endpoint to start over at if the others can't be reached, such as a replica in another region; can be repeated")
 	rootCmd.PersistentFlags().StringVarP(&region, "region", "r", "", "the region to use; AWS only (default \"us-east-1\")")
-	rootCmd.PersistentFlags().StringVarP(&bucket, "bucket", "b", "", "the bucket/space to upload to")
-	rootCmd.PersistentFlags().StringVarP(&remotePath, "path", "p", "", "the remote path at which we should put the file")
+	rootCmd.PersistentFlags().StringVarP(&bucket, "bucket", "b", "", "the bucket/space, or access point ARN, to upload to")
+	rootCmd.PersistentFlags().StringVarP(&remotePath, "path", "p", "", "the remote path at which we should put the file; when uploading files, the prefix to put them under")
 	rootCmd.PersistentFlags().IntVarP(&maxRetries, "retries", "t", 3, "the maximum number of times to retry uploading a part")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 0, "how long to wait before retrying a part, growing with each retry (default no wait)")
+	rootCmd.PersistentFlags().Float64Var(&retryMultiplier, "retry-multiplier", 2, "how much the wait grows by with each retry")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", 0, "the longest to wait between retries")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxElapsed, "retry-max-elapsed", 0, "give up on a part after trying for this long, even with retries left")
+	rootCmd.PersistentFlags().DurationVar(&partTimeout, "part-timeout", 0, "cut off and retry a part that takes longer than this to send, such as 2m")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "abort an upload that takes longer than this, such as 6h")
 	rootCmd.PersistentFlags().IntVarP(&maxPartSize, "part-size", "m", 5, "the maximum size per part, in megabytes")
+	rootCmd.PersistentFlags().IntVar(&minPartSize, "min-part-size", 0, "the smallest part size to allow, in megabytes, for providers that accept parts smaller than S3 does (default 5)")
+	rootCmd.PersistentFlags().StringVar(&singlePut, "single-put-under", "", "send inputs smaller than this, such as 64MB, in one request rather than in parts")
+	rootCmd.PersistentFlags().StringVar(&maxBytes, "max-bytes", "", "abort the upload if the input is bigger than this, such as 50GB")
+	rootCmd.PersistentFlags().StringVar(&expectedSize, "expected-size", "", "how big piped input will be, such as 12GB, for percentages and ETAs; can also be set with EXPECTED_SIZE")
 	rootCmd.PersistentFlags().BoolVarP(&silent, "silent", "s", false, "silence output, except errors")
 	rootCmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "output version information")
+	rootCmd.PersistentFlags().StringVar(&roleARN, "role-arn", "", "the ARN of an IAM role to assume before uploading")
+	rootCmd.PersistentFlags().StringVar(&externalID, "external-id", "", "the external ID to use when assuming a role")
+	rootCmd.PersistentFlags().StringVar(&roleSessionName, "role-session-name", "", "the session name to use when assuming a role")
+	rootCmd.PersistentFlags().DurationVar(&roleDuration, "role-duration", 0, "how long the assumed role's credentials should last (default 15m)")
+	rootCmd.PersistentFlags().StringVar(&sessionToken, "session-token", "", "the session token for temporary credentials; can also be set with SESSION_TOKEN")
+	rootCmd.PersistentFlags().StringVar(&signatureVersion, "signature-version", "v4", "the request signing version, v4 or v2; only use v2 for legacy gateways")
+	rootCmd.PersistentFlags().StringVar(&objectLockMode, "object-lock-mode", "", "the Object Lock mode, GOVERNANCE or COMPLIANCE; requires --retain-until")
+	rootCmd.PersistentFlags().StringVar(&retainUntil, "retain-until", "", "when the Object Lock retention expires, as an RFC 3339 date or a duration from now such as 720h")
+	rootCmd.PersistentFlags().BoolVar(&legalHold, "legal-hold", false, "place an Object Lock legal hold on the object")
+	rootCmd.PersistentFlags().BoolVar(&createBucket, "create-bucket", false, "create the bucket if it doesn't exist")
+	rootCmd.PersistentFlags().BoolVar(&versioning, "versioning", false, "enable versioning on buckets created with --create-bucket or mb")
+	rootCmd.PersistentFlags().BoolVar(&preflight, "preflight", false, "check that the bucket is reachable before reading any input")
+	rootCmd.PersistentFlags().DurationVar(&abortStale, "abort-stale", 0, "first abort incomplete uploads to the same path started longer ago than this, such as 24h")
+	rootCmd.PersistentFlags().BoolVar(&adaptive, "adaptive-part-size", false, "start with small parts and grow them as the upload goes on; --part-size becomes the cap (default 512)")
+	rootCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", 4, "the number of files to upload at once")
+	rootCmd.PersistentFlags().StringVar(&spillDir, "spill-dir", "", "keep parts in temporary files in this directory rather than in memory")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics at this address, such as :9100")
+	rootCmd.PersistentFlags().StringVar(&statsdAddr, "statsd-addr", "", "send stats to a statsd server at this address, such as localhost:8125")
+	rootCmd.PersistentFlags().StringVar(&statsdPrefix, "statsd-prefix", "pipedream.", "the prefix for statsd metric names")
+	rootCmd.PersistentFlags().IntVar(&eventsFD, "events-fd", 0, "write events as JSON lines to this file descriptor")
+	rootCmd.PersistentFlags().StringVar(&eventsFile, "events-file", "", "write events as JSON lines to this file")
+	rootCmd.PersistentFlags().StringVar(&summaryFormat, "summary", "text", "how to report the totals when done, text or json; json is printed even with --silent")
+	rootCmd.PersistentFlags().StringVar(&catalogPath, "catalog", "", "the file to record uploads in (default \"$XDG_DATA_HOME/pipedream/catalog.jsonl\")")
+	rootCmd.PersistentFlags().BoolVar(&noCatalog, "no-catalog", false, "don't record uploads in the catalog")
+	rootCmd.PersistentFlags().StringVar(&checksumAlgo, "checksum-algorithm", "", "have each part checked against a checksum: crc32, crc32c, sha1, sha256 or md5")
+	rootCmd.PersistentFlags().BoolVar(&noContentMD5, "no-content-md5", false, "don't send each part with a Content-MD5 header, for providers that don't support it")
+	rootCmd.PersistentFlags().StringArrayVar(&gpgRecipients, "gpg-recipient", nil, "encrypt the input with gpg to this key ID or email before uploading it; can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&ageRecipients, "age-recipient", nil, "encrypt the input with age to this public key, age1..., before uploading it; can be repeated")
+	rootCmd.PersistentFlags().BoolVar(&latest, "latest", false, "after each upload, copy it to --path with its placeholders replaced by \"latest\", such as db/latest.sql.gz")
+	rootCmd.PersistentFlags().IntVar(&keepDaily, "keep-daily", 0, "rotate uploads to a --path with {tier} in it, keeping this many daily ones")
+	rootCmd.PersistentFlags().IntVar(&keepWeekly, "keep-weekly", 0, "rotate uploads to a --path with {tier} in it, keeping this many weekly ones, from Sundays")
+	rootCmd.PersistentFlags().IntVar(&keepMonthly, "keep-monthly", 0, "rotate uploads to a --path with {tier} in it, keeping this many monthly ones, from the 1st")
+	rootCmd.PersistentFlags().StringArrayVar(&notifyEmails, "notify-email", nil, "email this address when done, using the SMTP_ settings; can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&notifyHooks, "notify", nil, "post a summary when done to a webhook, as KIND=URL where KIND is slack, discord, teams or webhook for plain JSON; can be repeated")
+	rootCmd.PersistentFlags().StringVar(&pingURL, "ping-url", "", "ping this healthchecks.io-style check when an upload starts, at /start, and when it ends, at the URL itself or at /fail")
+	rootCmd.PersistentFlags().StringVar(&resultFile, "result-file", "", "write a JSON record of how the last upload went to this file, for monitoring to check")
+	rootCmd.PersistentFlags().StringVar(&notifyOn, "notify-on", "always", "when to send notifications, always or only on failure")
+	rootCmd.PersistentFlags().BoolVar(&verify, "verify", false, "check the size and ETag of the object once it's uploaded")
+	rootCmd.PersistentFlags().StringVar(&splitSize, "split-size", "", "split input into objects of at most this size, such as 1TB, with a manifest at PATH.manifest")
+	rootCmd.PersistentFlags().StringVar(&partLimit, "part-limit", "fail", "what to do when the input is too big for 10,000 parts: fail, grow the parts, or split it into an object set as with --split-size")
+	rootCmd.PersistentFlags().BoolVar(&skipUnchanged, "skip-unchanged", false, "don't upload if the object already exists with the same SHA-256")
+	rootCmd.PersistentFlags().StringVar(&ifNotExists, "if-not-exists", "", "only upload if there's no object at the path yet; otherwise skip, or with --if-not-exists=fail, fail")
+	rootCmd.PersistentFlags().Lookup("if-not-exists").NoOptDefVal = "skip"
+	rootCmd.PersistentFlags().BoolVar(&public, "public", false, "let anyone download the object and print its URL when done, even with --silent")
+	rootCmd.PersistentFlags().StringVar(&contentHash, "content-hash", "", "the SHA-256 of the input, if known, so it needn't be read twice")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "dump requests and responses to stderr, with credentials redacted")
+	rootCmd.PersistentFlags().DurationVar(&heartbeat, "heartbeat", 0, "while a part is sending, report on it this often, such as 30s")
+	rootCmd.PersistentFlags().BoolVar(&timings, "timings", false, "show how long each part took to read and send")
+	rootCmd.Flags().StringArrayVar(&destURLs, "dest", nil, "also upload stdin to this s3://bucket/key; can be repeated")
+	rootCmd.Flags().StringVar(&fromURL, "from", "", "upload the object at s3://[ENDPOINT/]BUCKET/KEY rather than stdin; SOURCE_ACCESS_KEY and friends work as for mirror")
+	rootCmd.Flags().StringVar(&sourceEndpoint, "source-endpoint", "", "the endpoint of the --from object")
+	rootCmd.Flags().StringVar(&sourceRegion, "source-region", "", "the region of the --from object")
+	rootCmd.Flags().BoolVar(&tee, "tee", false, "copy stdin to stdout while uploading it; messages go to stderr instead")
+	rootCmd.Flags().BoolVar(&useTUI, "tui", false, "show live progress bars and a throughput graph; only when uploading from stdin")
+	rootCmd.PersistentFlags().IntVar(&maxIdleConns, "max-idle-conns", 0, "the number of idle connections to keep open to the endpoint (default 2)")
+	rootCmd.PersistentFlags().DurationVar(&idleTimeout, "idle-timeout", 0, "how long to keep idle connections open (default 90s)")
+	rootCmd.PersistentFlags().BoolVar(&noExpectContinue, "no-expect-continue", false, "don't send \"Expect: 100-continue\" with parts")
+	rootCmd.PersistentFlags().BoolVar(&noHTTP2, "no-http2", false, "only use HTTP/1.1")
+	rootCmd.PersistentFlags().StringVar(&awsProfile, "aws-profile", "", "a profile from ~/.aws/credentials and ~/.aws/config to use instead of ACCESS_KEY and SECRET_KEY")
+	rootCmd.PersistentFlags().StringVar(&envFile, "env-file", "", "read environment variables from this .env file; ones already set take precedence")
+	rootCmd.PersistentFlags().BoolVar(&instanceCredentials, "instance-credentials", false, "use the ECS task role or EC2 instance profile instead of ACCESS_KEY and SECRET_KEY")
 }
 
 func info() string {
 	b := strings.Builder{}
 	b.WriteString(wordwrap.String("A multipart uploader for Amazon S3, DigitalOcean Spaces, and S3-compatible systems.\n\n", wrapAt))
 	b.WriteString("Example:\n\n")
-	b.WriteString(wordwrap.String("    cat dump.rdb | gzip | pipedream -bucket backups -path dump.rdb.gz\n\n", wrapAt))
-	b.WriteString(wordwrap.String("ACCESS_KEY and SECRET_KEY must be set in the environment. ENDPOINT and REGION can also be set in the environment, but corresponding flags will take precedence. Also note that if you're using AWS you don't need to set the endpoint. Conversely, if you're using DigitalOcean you don't need to set the region.\n", wrapAt))
+	b.WriteString(wordwrap.String("    cat dump.rdb | gzip | pipedream -bucket backups -path dump.rdb.gz\n", wrapAt))
+	b.WriteString(wordwrap.String("    pipedream -bucket backups -path logs/ --jobs 8 /var/log/app\n", wrapAt))
+	b.WriteString(wordwrap.String("    pg_dump mydb | pipedream -bucket backups -path 'db/{timestamp}.sql' --latest\n\n", wrapAt))
+	b.WriteString(wordwrap.String("ACCESS_KEY and SECRET_KEY must be set in the environment, along with SESSION_TOKEN if they're temporary, unless running with IAM roles for service accounts (AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN) or with --instance-credentials. If they're not set, credentials are read from the shared AWS config and credentials files using AWS_PROFILE or --aws-profile. ENDPOINT and REGION can also be set in the environment, but corresponding flags will take precedence. Also note that if you're using AWS you don't need to set the endpoint. Conversely, if you're using DigitalOcean you don't need to set the region.\n\n", wrapAt))
+	b.WriteString(wordwrap.String("Any of these can be prefixed with PIPEDREAM_, such as PIPEDREAM_ACCESS_KEY, to keep them apart from other tools' settings; the prefixed ones take precedence. AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN are used when ACCESS_KEY, SECRET_KEY and SESSION_TOKEN aren't set. Use --env-file to read them from a .env file.\n\n", wrapAt))
+	b.WriteString(wordwrap.String("To fall back to a replica if the endpoint can't be reached, give --failover-endpoint; the upload starts over there. Files can be read again as they are, but input from stdin is first kept on disk, in --spill-dir if given.\n\n", wrapAt))
+	b.WriteString(wordwrap.String("For a second copy somewhere else, such as another region, give --replicate-to s3://bucket, along with --replica-endpoint or --replica-region if they differ. The copy is made by the storage service once the upload's done, under the same key.\n\n", wrapAt))
+	b.WriteString(wordwrap.String("To be emailed a summary when done, give --notify-email and set SMTP_HOST, along with SMTP_PORT (587 by default; 465 means TLS from the start), SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM as needed. To have it posted to Slack, Discord or Teams instead, give --notify with the channel's webhook, such as --notify slack=https://hooks.slack.com/.... To have a monitor such as healthchecks.io tell you when uploads stop, give its check as --ping-url; it's pinged at /start when an upload begins, and at the check itself or /fail when it ends. For monitoring that would rather read a file, --result-file keeps a JSON record of the last upload.\n", wrapAt))
 	return b.String()
 }
 
-func run(cmd *cobra.Command, args []string) error {
-	if showVersion {
-		fmt.Println(Version)
-		os.Exit(0)
-	}
-
+// newUpload builds an upload from the environment and flags.
+func newUpload(cmd *cobra.Command) (pipedream.MultipartUpload, error) {
 	// Get environment
 	var cfg config
 	if err := babyenv.Parse(&cfg); err != nil {
-		return fmt.Errorf("Could not parse config: %v", err)
+		return pipedream.MultipartUpload{}, fmt.Errorf("Could not parse config: %v", err)
+	}
+	if err := checkNotify(); err != nil {
+		return pipedream.MultipartUpload{}, err
 	}
 
 	var missing []string
 
+	// If no keys were given fall back to the shared AWS config, much like the
+	// AWS CLI does.
+	if awsProfile == "" && cfg.AccessKey == "" && cfg.SecretKey == "" && cfg.WebIdentityTokenFile == "" && !instanceCredentials {
+		awsProfile = cfg.Profile
+		if awsProfile == "" && sharedConfigExists() {
+			awsProfile = "default"
+		}
+	}
+
+	// Validate credentials. ACCESS_KEY and SECRET_KEY aren't needed if we're
+	// exchanging a web identity token for credentials, using a profile or
+	// using the instance's credentials.
+	if cfg.WebIdentityTokenFile == "" && !instanceCredentials && awsProfile == "" {
+		if cfg.AccessKey == "" {
+			missing = append(missing, "ACCESS_KEY")
+		}
+		if cfg.SecretKey == "" {
+			missing = append(missing, "SECRET_KEY")
+		}
+	}
+	if sessionToken == "" {
+		sessionToken = cfg.Token
+	}
+	if roleARN == "" {
+		roleARN = cfg.RoleARN
+	}
+	if roleSessionName == "" {
+		roleSessionName = cfg.RoleSessionName
+	}
+
 	// Validate CLI args
 	if endpoint == "" && cfg.Endpoint != "" {
 		endpoint = cfg.Endpoint
-	} else if endpoint == "" {
-		missing = append(missing, "endpoint")
+	} else if endpoint == "" && !strings.HasPrefix(bucket, "arn:") {
+		// Access point ARNs carry their own endpoint.
+		endpoint = "s3.amazonaws.com"
 	}
 	if region == "" && cfg.Region != "" {
 		region = cfg.Region
-	} else if region == "" {
-		missing = append(missing, "region")
+	} else if region == "" && awsProfile == "" {
+		// When using a profile we'll use its region instead.
+		region = pipedream.DefaultRegion
 	}
-	if bucket == "" {
+	if bucket == "" && cmd.Name() != "serve" && len(destURLs) == 0 {
+		// The gateway takes the bucket from each request, and --dest
+		// carries its own.
 		missing = append(missing, "bucket")
 	}
-	if remotePath == "" {
-		missing = append(missing, "path")
-	}
 	if len(missing) > 0 {
-		return fmt.Errorf("missing %s", pipedream.EnglishJoin(missing, true))
+		return pipedream.MultipartUpload{}, fmt.Errorf("missing %s", pipedream.EnglishJoin(missing, true))
+	}
+
+	if expectedSize == "" {
+		expectedSize = cfg.ExpectedSize
+	}
+	expectedBytes = 0
+	if expectedSize != "" {
+		size, err := humanize.ParseBytes(expectedSize)
+		if err != nil {
+			return pipedream.MultipartUpload{}, fmt.Errorf("bad expected size: %v", err)
+		}
+		expectedBytes = int64(size)
+	}
+
+	var limitPolicy pipedream.PartLimitPolicy
+	switch strings.ToLower(partLimit) {
+	case "fail", "split":
+		limitPolicy = pipedream.PartLimitFail
+	case "grow":
+		limitPolicy = pipedream.PartLimitGrow
+	default:
+		return pipedream.MultipartUpload{}, fmt.Errorf("unknown --part-limit action %q; use fail, grow or split", partLimit)
+	}
+
+	if minPartSize < 0 {
+		return pipedream.MultipartUpload{}, errors.New("--min-part-size can't be negative")
+	}
+	if min := pipedream.MinPartSize / pipedream.Megabyte; minPartSize == 0 && int64(maxPartSize) < min {
+		return pipedream.MultipartUpload{}, fmt.Errorf("--part-size must be at least %d, or use --min-part-size if your provider accepts smaller parts", min)
+	} else if minPartSize > 0 && maxPartSize < minPartSize {
+		return pipedream.MultipartUpload{}, fmt.Errorf("--part-size must be at least --min-part-size, %d", minPartSize)
+	}
+
+	partSize := pipedream.Megabyte * int64(maxPartSize)
+	if adaptive && !cmd.Flags().Changed("part-size") {
+		// Let the library pick the cap.
+		partSize = 0
+	} else if !cmd.Flags().Changed("part-size") && !splitAtLimit() && expectedBytes > partSize*pipedream.MaxParts {
+		// Make the parts big enough to fit the input in as many parts as
+		// S3 allows, to the nearest megabyte.
+		partSize = (expectedBytes/pipedream.MaxParts/pipedream.Megabyte + 1) * pipedream.Megabyte
+	}
+
+	var singlePutThreshold int64
+	if singlePut != "" {
+		size, err := humanize.ParseBytes(singlePut)
+		if err != nil {
+			return pipedream.MultipartUpload{}, fmt.Errorf("bad --single-put-under: %v", err)
+		}
+		singlePutThreshold = int64(size)
+	}
+
+	var maxSize int64
+	if maxBytes != "" {
+		size, err := humanize.ParseBytes(maxBytes)
+		if err != nil {
+			return pipedream.MultipartUpload{}, fmt.Errorf("bad --max-bytes: %v", err)
+		}
+		maxSize = int64(size)
+	}
+
+	var sigVersion pipedream.SignatureVersion
+	switch strings.ToLower(signatureVersion) {
+	case "v4", "4":
+		sigVersion = pipedream.SignatureV4
+	case "v2", "2":
+		sigVersion = pipedream.SignatureV2
+	default:
+		return pipedream.MultipartUpload{}, fmt.Errorf("unknown signature version %q; use v4 or v2", signatureVersion)
 	}
 
-	// Is stdin a pipe?
-	info, err := os.Stdin.Stat()
+	var ifExists pipedream.ExistsPolicy
+	switch strings.ToLower(ifNotExists) {
+	case "":
+		ifExists = pipedream.Overwrite
+	case "skip":
+		ifExists = pipedream.SkipIfExists
+	case "fail":
+		ifExists = pipedream.FailIfExists
+	default:
+		return pipedream.MultipartUpload{}, fmt.Errorf("unknown --if-not-exists action %q; use skip or fail", ifNotExists)
+	}
+
+	var retainUntilDate time.Time
+	if retainUntil != "" {
+		var err error
+		if retainUntilDate, err = parseRetainUntil(retainUntil); err != nil {
+			return pipedream.MultipartUpload{}, err
+		}
+	}
+
+	m := pipedream.MultipartUpload{
+		AccessKey:    cfg.AccessKey,
+		SecretKey:    cfg.SecretKey,
+		SessionToken: sessionToken,
+		Endpoint:     endpoint,
+		Region:       region,
+		MaxRetries:   maxRetries,
+		MaxPartSize:  partSize,
+		Bucket:       bucket,
+
+		FailoverEndpoints: failover,
+
+		MinimumPartSize: pipedream.Megabyte * int64(minPartSize),
+
+		RetryPolicy: pipedream.RetryPolicy{
+			InitialDelay: retryBackoff,
+			Multiplier:   retryMultiplier,
+			MaxDelay:     retryMaxDelay,
+			MaxElapsed:   retryMaxElapsed,
+		},
+		SinglePutThreshold: singlePutThreshold,
+		MaxBytes:           maxSize,
+		PartTimeout:        partTimeout,
+		Timeout:            timeout,
+
+		RoleARN:         roleARN,
+		ExternalID:      externalID,
+		RoleSessionName: roleSessionName,
+		RoleDuration:    roleDuration,
+
+		WebIdentityTokenFile:   cfg.WebIdentityTokenFile,
+		UseInstanceCredentials: instanceCredentials,
+		Profile:                awsProfile,
+
+		SignatureVersion: sigVersion,
+
+		ObjectLockMode: strings.ToUpper(objectLockMode),
+		RetainUntil:    retainUntilDate,
+		LegalHold:      legalHold,
+
+		CreateBucket:     createBucket,
+		EnableVersioning: versioning,
+		Preflight:        preflight,
+		AbortStaleAfter:  abortStale,
+		AdaptivePartSize: adaptive,
+		PartLimit:        limitPolicy,
+		ReportTimings:    timings || metricsAddr != "" || statsdAddr != "",
+		SpillToDisk:      spillDir != "",
+		SpillDir:         spillDir,
+		DebugWriter:      debugWriter(),
+
+		HeartbeatInterval: heartbeat,
+		Verify:            verify,
+		ContentHash:       contentHash,
+		SkipUnchanged:     skipUnchanged,
+		IfExists:          ifExists,
+		ChecksumAlgorithm: pipedream.ChecksumAlgorithm(strings.ToUpper(checksumAlgo)),
+		NoContentMD5:      noContentMD5,
+		ACL:               cannedACL(),
+
+		Transport: pipedream.TransportConfig{
+			MaxIdleConnsPerHost:   maxIdleConns,
+			IdleConnTimeout:       idleTimeout,
+			DisableExpectContinue: noExpectContinue,
+			DisableHTTP2:          noHTTP2,
+		},
+	}
+	var err error
+	if m.ReplicateTo, err = replicaOf(m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func run(cmd *cobra.Command, args []string) (err error) {
+	if showVersion {
+		fmt.Println(Version)
+		os.Exit(0)
+	}
+
+	// Set up notifications first, so that a run that fails because it's
+	// misconfigured is reported like any other failure.
+	if err := checkNotify(); err != nil {
+		return err
+	}
+	start := time.Now()
+	defer func() {
+		target := fmt.Sprintf("s3://%s/%s", bucket, remotePath)
+		if len(destURLs) > 0 {
+			target = strings.Join(destURLs, ", ")
+		}
+		notify(tally.result(target, remotePath, start, err))
+	}()
+	pingStart()
+
+	m, err := newUpload(cmd)
 	if err != nil {
 		return err
 	}
-	if info.Mode()&os.ModeCharDevice != 0 {
-		return errors.New("input must be through a pipe")
+	if summaryFormat != "text" && summaryFormat != "json" {
+		return fmt.Errorf("unknown summary format %q; use text or json", summaryFormat)
 	}
 
-	m := pipedream.MultipartUpload{
-		AccessKey:   cfg.AccessKey,
-		SecretKey:   cfg.SecretKey,
-		Endpoint:    endpoint,
-		Region:      region,
-		MaxRetries:  maxRetries,
-		MaxPartSize: pipedream.Megabyte * int64(maxPartSize),
-		Bucket:      bucket,
+	// The flags are fine, so there's no need to show usage if the upload
+	// itself fails.
+	cmd.SilenceUsage = true
+
+	if fromURL != "" && len(args) > 0 {
+		return errors.New("--from can't be used with files to upload")
+	}
+	if tee && (len(args) > 0 || useTUI) {
+		return errors.New("--tee only works when uploading stdin, without --tui")
+	}
+	if tee {
+		// stdout is for the data now, so everything we'd normally print
+		// there goes to stderr.
+		teeOut = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	if len(destURLs) > 0 && (len(args) > 0 || splitSize != "" || useTUI) {
+		return errors.New("--dest only works when uploading stdin, without --split-size or --tui")
+	}
+	if len(destURLs) > 0 && skipUnchanged && contentHash == "" {
+		return errors.New("--skip-unchanged with --dest needs --content-hash")
+	}
+	if useTUI && (len(args) > 0 || splitSize != "") {
+		return errors.New("--tui only works when uploading a single stream from stdin")
+	}
+	if useTUI && silent {
+		return errors.New("--tui and --silent can't be used together")
+	}
+	if latest && (len(args) > 0 || len(destURLs) > 0 || splitSize != "") {
+		return errors.New("--latest only works when uploading a single object from stdin")
+	}
+	if rotating() && (len(args) > 0 || len(destURLs) > 0 || splitSize != "") {
+		return errors.New("rotating uploads only works when uploading a single object from stdin")
+	}
+	encryption, err := encryptionFlag()
+	if err != nil {
+		return err
+	}
+	if encryption != "" && (len(args) > 0 || tee) {
+		return fmt.Errorf("%s only works when uploading stdin, without --tee", encryption)
+	}
+	if encryption != "" && (skipUnchanged || contentHash != "") {
+		// What's uploaded is encrypted afresh each time, so its hash is never
+		// that of the input, nor the same twice.
+		return fmt.Errorf("%s can't be used with --skip-unchanged or --content-hash", encryption)
+	}
+
+	if len(args) > 0 {
+		files, err := collectFiles(args, remotePath)
+		if err != nil {
+			return err
+		}
+		return uploadFiles(m, files)
+	}
+
+	// The expected size is of stdin as a whole, not of each object in a set.
+	if splitSize == "" {
+		m.Size = expectedBytes
+	}
+
+	var dests []destination
+	if len(destURLs) > 0 {
+		if dests, err = collectDestinations(m, destURLs); err != nil {
+			return err
+		}
+	} else if remotePath == "" {
+		return errors.New("missing path")
+	}
+
+	// The path can have the same placeholders as for schedule.
+	tmpl := remotePath
+	remotePath = expandKey(tmpl, 1, time.Now())
+	if latest {
+		if _, err := latestKey(tmpl); err != nil {
+			return err
+		}
+	}
+	if err := checkRotation(tmpl); err != nil {
+		return err
+	}
+
+	var stdin io.Reader = os.Stdin
+	if fromURL != "" {
+		body, size, err := openSource(m, fromURL)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		stdin = body
+		if m.Size == 0 && splitSize == "" {
+			m.Size = size
+			for i := range dests {
+				dests[i].upload.Size = size
+			}
+		}
+	} else {
+		// Is stdin a pipe?
+		info, err := os.Stdin.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeCharDevice != 0 {
+			return errors.New("input must be through a pipe")
+		}
+	}
+
+	if len(gpgRecipients) > 0 {
+		encrypted, kill, err := gpgEncrypt(stdin, gpgRecipients)
+		if err != nil {
+			return err
+		}
+		// Make sure gpg isn't left running, or blocked writing to a pipe
+		// nobody's reading, if the upload stops short.
+		defer kill()
+		stdin = encrypted
+	}
+	if len(ageRecipients) > 0 {
+		recipients, err := parseAgeRecipients(ageRecipients)
+		if err != nil {
+			return err
+		}
+		stdin = ageEncrypt(stdin, recipients)
+	}
+
+	if tee {
+		stdin = io.TeeReader(stdin, teeOut)
+		// Pass on whatever the upload didn't read, as when it fails, so the
+		// rest of the pipeline isn't cut short.
+		defer func() {
+			if _, err := io.Copy(io.Discard, stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "could not pass input through: %v\n", err)
+			}
+		}()
+	}
+
+	if len(dests) > 0 {
+		return uploadDestinations(dests, stdin)
+	}
+
+	if splitAtLimit() && splitSize == "" {
+		if size := stdinSize(m, stdin); size > m.Capacity() {
+			if latest {
+				return fmt.Errorf("%s is too big for one object with this part size, and --latest can't be used with object sets", humanize.Bytes(uint64(size)))
+			}
+			if rotating() {
+				return fmt.Errorf("%s is too big for one object with this part size, and object sets can't be rotated", humanize.Bytes(uint64(size)))
+			}
+			if !silent {
+				fmt.Printf("%s %s is too big for one object with this part size, so it'll be split\n", arrow, humanize.Bytes(uint64(size)))
+			}
+			m.Size = 0
+			return uploadSet(m, stdin, remotePath, m.Capacity())
+		}
+	}
+
+	if splitSize != "" {
+		size, err := humanize.ParseBytes(splitSize)
+		if err != nil {
+			return fmt.Errorf("bad --split-size: %v", err)
+		}
+		if size == 0 {
+			return errors.New("--split-size must be more than zero")
+		}
+		return uploadSet(m, stdin, remotePath, int64(size))
+	}
+
+	// Without a hash to go on the input has to be read in full before we
+	// know whether to upload it, so keep it on disk in the meantime. The
+	// same goes for starting over at a failover endpoint.
+	input := stdin
+	if (skipUnchanged && contentHash == "") || len(failover) > 0 {
+		f, err := spool(stdin)
+		if err != nil {
+			return fmt.Errorf("could not spool input: %v", err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		input = f
+	}
+
+	// The TUI has a bar for the part being sent, which needs heartbeats to
+	// move.
+	if useTUI && m.HeartbeatInterval == 0 {
+		m.HeartbeatInterval = tuiHeartbeat
 	}
 
 	now := time.Now()
 
-	ch := m.Send(os.Stdin, remotePath)
-	done := make(chan struct{})
-
-	fmt.Printf("%s Starting upload...\n", arrow)
-
-	go func() {
-		for {
-			select {
-			case e := <-ch:
-				switch e := e.(type) {
-				case pipedream.Progress:
-					if !silent {
-						bytes := humanize.Bytes(uint64(e.Bytes))
-						fmt.Printf("%s Uploaded part #%d %s\n", arrow, e.PartNumber, subtle(bytes))
-					}
-				case pipedream.Retry:
-					if !silent {
-						details := fmt.Sprintf("try %d of %d", e.RetryNumber, e.MaxRetries)
-						fmt.Printf("Retrying part #%d %s\n", e.PartNumber, subtle(details))
-					}
-				case pipedream.Error:
-					if !silent {
-						errMsg := strings.Replace(e.Error(), "\n", "", -1)
-						errMsg = strings.Replace(errMsg, "\t", " ", -1)
-						errMsg = indent.String(wordwrap.String(errMsg, wrapAt-errorIndent), errorIndent)
-						fmt.Printf("%s Upload failed:\n\n%s\n\n", ex, errMsg)
-					}
-					close(done)
-					break
-				case pipedream.Complete:
-					if !silent {
-						fmt.Printf("%s Done. Sent %s in %s.\n", check, humanize.Bytes(uint64(e.Bytes)), time.Since(now).Round(time.Millisecond))
-					}
-					close(done)
-					break
+	ch, err := m.Start(input, remotePath)
+	if err != nil {
+		return err
+	}
+	metrics.started()
+	stats.started()
+
+	// With the TUI up it does the talking, so print nothing else until it's
+	// gone.
+	quiet := silent
+	var ui *tui
+	if useTUI {
+		if ui, err = startTUI(fmt.Sprintf("s3://%s/%s", m.Bucket, remotePath), m.Abort); err != nil {
+			m.Abort()
+			for range ch {
+			}
+			return err
+		}
+		quiet = true
+	} else {
+		fmt.Printf("%s Starting upload...\n", arrow)
+	}
+
+	var (
+		shareURL   string
+		completed  bool
+		replicated *pipedream.Replicated
+		failed     error
+	)
+	for e := range ch {
+		metrics.observe(e)
+		stats.observe(e)
+		tally.observe(e)
+		events.write(remotePath, e)
+		if ui != nil {
+			ui.send(e)
+		}
+		switch e := e.(type) {
+		case pipedream.Progress:
+			if !quiet {
+				details := humanize.Bytes(uint64(e.Bytes))
+				if e.Size > 0 {
+					details += fmt.Sprintf(", %.0f%%, %s/s, %s left", e.Percent, humanize.Bytes(uint64(e.Rate)), e.ETA.Round(time.Second))
+				} else {
+					details += fmt.Sprintf(", %s/s", humanize.Bytes(uint64(e.Rate)))
+				}
+				fmt.Printf("%s Uploaded part #%d %s\n", arrow, e.PartNumber, subtle(details))
+			}
+		case pipedream.Timing:
+			if timings && !quiet {
+				details := fmt.Sprintf("read %s, waited %s, sent in %s",
+					e.ReadTime.Round(time.Millisecond),
+					e.WaitTime.Round(time.Millisecond),
+					e.NetworkTime.Round(time.Millisecond),
+				)
+				fmt.Printf("  %s\n", subtle(details))
+			}
+		case pipedream.Heartbeat:
+			if !quiet {
+				details := fmt.Sprintf("%s of %s after %s", humanize.Bytes(uint64(e.InFlight)), humanize.Bytes(uint64(e.PartSize)), e.Elapsed.Round(time.Second))
+				fmt.Printf("%s Still sending part #%d %s\n", arrow, e.PartNumber, subtle(details))
+			}
+		case pipedream.Retry:
+			if !quiet {
+				details := fmt.Sprintf("try %d of %d", e.RetryNumber, e.MaxRetries)
+				if e.Delay > 0 {
+					details += fmt.Sprintf(" in %s", e.Delay.Round(time.Millisecond))
+				}
+				fmt.Printf("Retrying part #%d %s\n", e.PartNumber, subtle(details))
+			}
+		case pipedream.Replicated:
+			// It comes just before the Complete, but reads better after.
+			replicated = &e
+		case pipedream.Failover:
+			if !quiet {
+				printFailure(fmt.Sprintf("Couldn't reach %s, so starting over at %s", e.From, e.To), e.Err)
+			}
+		case pipedream.Error:
+			failed = e
+			if !quiet {
+				printFailure("Upload failed", e)
+			}
+			if jsonSummary() {
+				summaryReport{Error: e.Error()}.print()
+			}
+		case pipedream.Aborted:
+			failed = e
+			if !quiet {
+				printFailure("Upload failed and was aborted", e.Reason)
+			}
+			if jsonSummary() {
+				summaryReport{Error: e.Error()}.print()
+			}
+		case pipedream.Complete:
+			if e.Skipped {
+				if !quiet {
+					fmt.Printf("%s %s\n", check, skippedMessage())
 				}
+				continue
+			}
+			catalog.record(m, remotePath, e)
+			completed = true
+			if public {
+				shareURL = objectURL(m, remotePath)
+			}
+			s := e.Summary
+			if jsonSummary() {
+				r := summaryReport{URL: shareURL}
+				r.add(s)
+				r.finish(s.Duration)
+				r.print()
+			} else if !quiet {
+				fmt.Printf("%s Done. Sent %s in %s. %s\n", check, humanize.Bytes(uint64(e.Bytes)), time.Since(now).Round(time.Millisecond), subtle(describeSummary(s.Parts, s.Retries, s.Throughput)))
 			}
 		}
-	}()
+	}
+
+	if ui != nil {
+		if err := ui.close(); err != nil {
+			return fmt.Errorf("TUI failed: %v", err)
+		}
+	}
+	if replicated != nil {
+		printReplicated(*replicated)
+	}
+	if failed != nil {
+		// Unless we were asked to keep quiet, it's been printed already.
+		cmd.SilenceErrors = !silent
+		return failed
+	}
+	if latest && completed {
+		if err := pointLatest(m, tmpl, remotePath); err != nil {
+			return err
+		}
+	}
+	if rotating() && completed {
+		if err := rotate(m, tmpl); err != nil {
+			return err
+		}
+	}
+	if shareURL != "" && !jsonSummary() {
+		fmt.Println(shareURL)
+	}
 
-	<-done
+	return nil
+}
 
+// startReporting sets up the metrics, stats and event log asked for with
+// flags.
+func startReporting() error {
+	if metricsAddr != "" {
+		if err := serveMetrics(metricsAddr); err != nil {
+			return fmt.Errorf("could not serve metrics: %v", err)
+		}
+	}
+	if statsdAddr != "" {
+		if err := dialStatsd(statsdAddr, statsdPrefix); err != nil {
+			return fmt.Errorf("could not set up statsd: %v", err)
+		}
+	}
+	if err := openEventLog(eventsFD, eventsFile); err != nil {
+		return fmt.Errorf("could not open event log: %v", err)
+	}
+	if err := openCatalog(); err != nil {
+		return fmt.Errorf("could not open catalog: %v", err)
+	}
 	return nil
 }
 
+// debugWriter returns where to dump requests and responses with --debug.
+func debugWriter() io.Writer {
+	if !debug {
+		return nil
+	}
+	return os.Stderr
+}
+
+// printFailure prints an error, wrapped and indented under a heading.
+func printFailure(heading string, err error) {
+	errMsg := strings.Replace(err.Error(), "\n", "", -1)
+	errMsg = strings.Replace(errMsg, "\t", " ", -1)
+	errMsg = indent.String(wordwrap.String(errMsg, wrapAt-errorIndent), errorIndent)
+	fmt.Printf("%s %s:\n\n%s\n\n", ex, heading, errMsg)
+}
+
+// cannedACL returns the ACL to give uploads, if the flags ask for one.
+func cannedACL() string {
+	if public {
+		return s3.ObjectCannedACLPublicRead
+	}
+	return ""
+}
+
+// objectURL returns the URL of an uploaded object. If it can't be worked out
+// the problem is printed and "" is returned, since the upload itself was
+// fine.
+func objectURL(m pipedream.MultipartUpload, key string) string {
+	u, err := m.URL(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not work out the URL of %s: %v\n", key, err)
+		return ""
+	}
+	return u
+}
+
+// parseRetainUntil parses an Object Lock retention date, given either as an
+// RFC 3339 timestamp or as a duration from now.
+func parseRetainUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse retention date %q; use an RFC 3339 date or a duration like 720h", s)
+	}
+	return time.Now().Add(d), nil
+}
+
+// sharedConfigExists returns whether there's a shared AWS config or
+// credentials file we could read a profile from.
+func sharedConfigExists() bool {
+	var paths []string
+	if p := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); p != "" {
+		paths = append(paths, p)
+	}
+	if p := os.Getenv("AWS_CONFIG_FILE"); p != "" {
+		paths = append(paths, p)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(home, ".aws", "credentials"),
+			filepath.Join(home, ".aws", "config"),
+		)
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func main() {
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
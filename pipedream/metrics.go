@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/meowgorithm/pipedream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// uploadMetrics collects Prometheus metrics from upload events. A nil
+// *uploadMetrics does nothing, so callers needn't check whether metrics are
+// turned on.
+type uploadMetrics struct {
+	bytes      prometheus.Counter
+	parts      prometheus.Counter
+	retries    prometheus.Counter
+	uploads    *prometheus.CounterVec
+	active     prometheus.Gauge
+	partTime   prometheus.Histogram
+	throughput prometheus.Histogram
+}
+
+// metrics is set when --metrics-addr is given.
+var metrics *uploadMetrics
+
+func newUploadMetrics(reg prometheus.Registerer) *uploadMetrics {
+	m := &uploadMetrics{
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pipedream_uploaded_bytes_total",
+			Help: "Bytes successfully uploaded.",
+		}),
+		parts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pipedream_uploaded_parts_total",
+			Help: "Parts successfully uploaded.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pipedream_part_retries_total",
+			Help: "Part uploads that failed and were retried.",
+		}),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pipedream_uploads_total",
+			Help: "Finished uploads, by result.",
+		}, []string{"result"}),
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pipedream_active_uploads",
+			Help: "Uploads in progress.",
+		}),
+		partTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pipedream_part_upload_seconds",
+			Help:    "Time taken to send a part, including retries.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+		}),
+		throughput: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pipedream_part_throughput_bytes_per_second",
+			Help:    "Transfer rate of each part.",
+			Buckets: prometheus.ExponentialBuckets(64*1024, 2, 14),
+		}),
+	}
+	reg.MustRegister(m.bytes, m.parts, m.retries, m.uploads, m.active, m.partTime, m.throughput)
+
+	// Make both results show up before anything has finished.
+	m.uploads.WithLabelValues("success")
+	m.uploads.WithLabelValues("failure")
+
+	return m
+}
+
+// serveMetrics starts serving metrics at addr in the background.
+func serveMetrics(addr string) error {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	metrics = newUploadMetrics(reg)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// started records the start of an upload.
+func (m *uploadMetrics) started() {
+	if m == nil {
+		return
+	}
+	m.active.Inc()
+}
+
+// observe records an upload event.
+func (m *uploadMetrics) observe(e pipedream.Event) {
+	if m == nil {
+		return
+	}
+	switch e := e.(type) {
+	case pipedream.Progress:
+		m.bytes.Add(float64(e.Bytes))
+		m.parts.Add(float64(e.Parts))
+	case pipedream.Timing:
+		secs := e.NetworkTime.Seconds()
+		m.partTime.Observe(secs)
+		if secs > 0 {
+			m.throughput.Observe(float64(e.Bytes) / secs)
+		}
+	case pipedream.Retry:
+		m.retries.Inc()
+	case pipedream.Complete:
+		m.active.Dec()
+		m.uploads.WithLabelValues("success").Inc()
+	case pipedream.Error, pipedream.Aborted:
+		m.active.Dec()
+		m.uploads.WithLabelValues("failure").Inc()
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/babyenv"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sourceEndpoint string
+	sourceRegion   string
+	noServerSide   bool
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror s3://SOURCE[/PREFIX] s3://DEST[/PREFIX]",
+	Short: "Copy the objects under a prefix to another bucket",
+	Long: `Copy every object under a prefix to another bucket, which can be on a
+different service. The destination is set up like any other upload. The source
+uses the same credentials and endpoint unless SOURCE_ACCESS_KEY,
+SOURCE_SECRET_KEY, SOURCE_SESSION_TOKEN, SOURCE_ENDPOINT or SOURCE_REGION are
+set, or --source-endpoint or --source-region are given.
+
+When both buckets are on the same service objects are copied server-side.
+Otherwise they're streamed through pipedream, without touching the disk.`,
+	Args: cobra.ExactArgs(2),
+	RunE: mirror,
+}
+
+func init() {
+	mirrorCmd.Flags().StringVar(&sourceEndpoint, "source-endpoint", "", "the endpoint of the source bucket")
+	mirrorCmd.Flags().StringVar(&sourceRegion, "source-region", "", "the region of the source bucket")
+	mirrorCmd.Flags().BoolVar(&noServerSide, "no-server-side", false, "always stream objects through pipedream")
+	rootCmd.AddCommand(mirrorCmd)
+}
+
+type sourceConfig struct {
+	AccessKey string `env:"SOURCE_ACCESS_KEY"`
+	SecretKey string `env:"SOURCE_SECRET_KEY"`
+	Token     string `env:"SOURCE_SESSION_TOKEN"`
+	Endpoint  string `env:"SOURCE_ENDPOINT"`
+	Region    string `env:"SOURCE_REGION"`
+}
+
+func mirror(cmd *cobra.Command, args []string) error {
+	srcBucket, srcPrefix, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	dstBucket, dstPrefix, err := parseS3URL(args[1])
+	if err != nil {
+		return err
+	}
+	bucket = dstBucket
+
+	dst, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+
+	var cfg sourceConfig
+	if err := babyenv.Parse(&cfg); err != nil {
+		return fmt.Errorf("Could not parse config: %v", err)
+	}
+	src, ownCreds := sourceUpload(dst, cfg)
+	src.Bucket = srcBucket
+	serverSide := !noServerSide && !ownCreds && src.Endpoint == dst.Endpoint && src.Region == dst.Region
+
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	// Don't let a prefix of "logs" pick up "logs-old/".
+	if srcPrefix != "" && !strings.HasSuffix(srcPrefix, "/") {
+		srcPrefix += "/"
+	}
+	objects, err := src.List(srcPrefix)
+	if err != nil {
+		return fmt.Errorf("could not list %s: %v", args[0], err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects under %s", args[0])
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		mtx       sync.Mutex
+		wg        sync.WaitGroup
+		failed    int
+		sent      int64
+		now       = time.Now()
+		queue     = make(chan pipedream.Object)
+		printLine = func(format string, a ...interface{}) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			fmt.Printf(format, a...)
+		}
+	)
+
+	if !silent {
+		fmt.Printf("%s Mirroring %d objects, %d at a time...\n", arrow, len(objects), jobs)
+	}
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range queue {
+				key := joinKey(dstPrefix, strings.TrimPrefix(o.Key, srcPrefix))
+				from := fmt.Sprintf("s3://%s/%s", srcBucket, o.Key)
+				start := time.Now()
+
+				var err error
+				if serverSide {
+					err = dst.Copy(srcBucket, o.Key, key)
+					if err == nil {
+						_ = catalog.add(catalogEntry{
+							Time:     time.Now().UTC(),
+							Endpoint: dst.Endpoint,
+							Bucket:   dst.Bucket,
+							Key:      key,
+							Bytes:    o.Size,
+							ETag:     o.ETag,
+							Duration: time.Since(start).Seconds(),
+						})
+					}
+				} else {
+					err = streamObject(src, dst, o, key)
+				}
+
+				mtx.Lock()
+				if err != nil {
+					failed++
+				} else {
+					sent += o.Size
+				}
+				mtx.Unlock()
+
+				if err != nil {
+					printLine("%s %s %s\n", ex, from, subtle(err.Error()))
+					continue
+				}
+				if !silent {
+					details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(o.Size)), time.Since(start).Round(time.Millisecond))
+					printLine("%s %s %s s3://%s/%s %s\n", check, from, arrow, dstBucket, key, subtle(details))
+				}
+			}
+		}()
+	}
+
+	for _, o := range objects {
+		queue <- o
+	}
+	close(queue)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed to mirror", failed, len(objects))
+	}
+	if !silent {
+		fmt.Printf("%s Done. Mirrored %d objects, %s, in %s.\n", check, len(objects), humanize.Bytes(uint64(sent)), time.Since(now).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// sourceUpload returns the settings for reading the source bucket, based on
+// the destination's, and whether it has credentials of its own.
+func sourceUpload(dst pipedream.MultipartUpload, cfg sourceConfig) (pipedream.MultipartUpload, bool) {
+	src := dst
+	ownCreds := cfg.AccessKey != "" || cfg.SecretKey != ""
+	if ownCreds {
+		src.AccessKey = cfg.AccessKey
+		src.SecretKey = cfg.SecretKey
+		src.SessionToken = cfg.Token
+		src.Profile = ""
+		src.RoleARN = ""
+		src.WebIdentityTokenFile = ""
+		src.UseInstanceCredentials = false
+	}
+
+	switch {
+	case sourceEndpoint != "":
+		src.Endpoint = sourceEndpoint
+	case cfg.Endpoint != "":
+		src.Endpoint = cfg.Endpoint
+	}
+	switch {
+	case sourceRegion != "":
+		src.Region = sourceRegion
+	case cfg.Region != "":
+		src.Region = cfg.Region
+	}
+	return src, ownCreds
+}
+
+// streamObject downloads an object from the source and uploads it to key in
+// the destination as it arrives.
+func streamObject(src, dst pipedream.MultipartUpload, o pipedream.Object, key string) error {
+	body, info, err := src.Get(o.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dst.Size = info.Size
+	_, err = sendReader(dst, body, key)
+	return err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+)
+
+var (
+	notifyEmails []string
+	notifyOn     string
+	smtpSettings smtpConfig
+)
+
+// runResult is how a run went: one invocation, or one upload of a schedule or
+// listen. It's what notifications report.
+type runResult struct {
+	Target   string
+	Key      string
+	Bytes    int64
+	ETag     string
+	Checksum string
+	Duration time.Duration
+	Err      error
+}
+
+// uploadResult returns the result of a single upload to key that started at
+// start.
+func uploadResult(m pipedream.MultipartUpload, key string, start time.Time, c pipedream.Complete, err error) runResult {
+	r := runResult{
+		Target:   fmt.Sprintf("s3://%s/%s", m.Bucket, key),
+		Key:      key,
+		Bytes:    c.Summary.Bytes,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	r.ETag, r.Checksum = uploadChecksums(c.Result)
+	return r
+}
+
+// subject returns a one-line summary of the result.
+func (r runResult) subject() string {
+	if r.Err != nil {
+		return fmt.Sprintf("pipedream: upload to %s failed", r.Target)
+	}
+	return fmt.Sprintf("pipedream: uploaded %s to %s", humanize.Bytes(uint64(r.Bytes)), r.Target)
+}
+
+// fact is a detail of a result, such as how much was sent.
+type fact struct {
+	name, value string
+}
+
+// facts returns the details of the result, for notifications to lay out.
+func (r runResult) facts() []fact {
+	var facts []fact
+	if host, err := os.Hostname(); err == nil {
+		facts = append(facts, fact{"Host", host})
+	}
+	facts = append(facts,
+		fact{"Sent", fmt.Sprintf("%s (%d bytes)", humanize.Bytes(uint64(r.Bytes)), r.Bytes)},
+		fact{"Duration", r.Duration.Round(time.Millisecond).String()},
+	)
+	if r.Err != nil {
+		facts = append(facts, fact{"Error", r.Err.Error()})
+	}
+	return facts
+}
+
+// details describes the result for humans.
+func (r runResult) details() string {
+	var b strings.Builder
+	if r.Err != nil {
+		fmt.Fprintf(&b, "The upload to %s failed.\n\n", r.Target)
+	} else {
+		fmt.Fprintf(&b, "The upload to %s succeeded.\n\n", r.Target)
+	}
+	for _, f := range r.facts() {
+		fmt.Fprintf(&b, "%-9s %s\n", f.name+":", f.value)
+	}
+	return b.String()
+}
+
+// checkNotify checks the notification flags, and reads the settings any
+// notifications need.
+func checkNotify() error {
+	switch notifyOn {
+	case "always", "failure":
+	default:
+		return fmt.Errorf("unknown --notify-on %q; use always or failure", notifyOn)
+	}
+	if len(notifyEmails) > 0 {
+		cfg, err := loadSMTPConfig()
+		if err != nil {
+			return err
+		}
+		smtpSettings = cfg
+	}
+	hooks, err := parseChatHooks(notifyHooks)
+	if err != nil {
+		return err
+	}
+	chatHooks = hooks
+	if pingCheck, err = parsePingURL(pingURL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// notify sends the result wherever notifications were asked for, and records
+// it in any result file. Failing to send one is reported, but doesn't fail the
+// run.
+func notify(r runResult) {
+	// Checks and result files need to hear about every upload, not just
+	// failures, to tell when they've stopped.
+	pingResult(r)
+	writeResultFile(r)
+	if r.Err == nil && notifyOn == "failure" {
+		return
+	}
+	if len(notifyEmails) > 0 {
+		if err := sendEmail(smtpSettings, notifyEmails, r.subject(), r.details()); err != nil {
+			fmt.Fprintf(os.Stderr, "%s could not send email: %v\n", ex, err)
+		}
+	}
+	for _, h := range chatHooks {
+		if err := h.send(r); err != nil {
+			fmt.Fprintf(os.Stderr, "%s could not notify %s: %v\n", ex, h.kind, err)
+		}
+	}
+}
+
+// runTally adds up the uploads in a run, for when there's more than one or
+// their failures aren't returned, as with a single upload from stdin.
+type runTally struct {
+	mtx   sync.Mutex
+	bytes int64
+	last  pipedream.Complete
+	err   error
+}
+
+// tally is the tally of the current run.
+var tally runTally
+
+// observe records an upload event.
+func (t *runTally) observe(e pipedream.Event) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	switch e := e.(type) {
+	case pipedream.Complete:
+		t.bytes += int64(e.Bytes)
+		t.last = e
+	case pipedream.Error:
+		if t.err == nil {
+			t.err = e
+		}
+	case pipedream.Aborted:
+		if t.err == nil {
+			t.err = e
+		}
+	}
+}
+
+// result returns the result of a run to key that started at start and ended
+// with err, which wins over any failure seen along the way. The checksums are
+// those of the last upload to finish.
+func (t *runTally) result(target, key string, start time.Time, err error) runResult {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if err == nil {
+		err = t.err
+	}
+	r := runResult{Target: target, Key: key, Bytes: t.bytes, Duration: time.Since(start), Err: err}
+	r.ETag, r.Checksum = uploadChecksums(t.last.Result)
+	return r
+}
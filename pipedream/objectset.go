@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+)
+
+// maxParts is the most parts S3 allows in one upload.
+const maxParts = 10000
+
+// manifestSuffix is added to the key of an object set to get the key of its
+// manifest.
+const manifestSuffix = ".manifest"
+
+// setManifest describes an object set: a stream too large for one object,
+// stored as several objects one after another.
+type setManifest struct {
+	Version int         `json:"version"`
+	Key     string      `json:"key"`
+	Bytes   int64       `json:"bytes"`
+	Created time.Time   `json:"created"`
+	Objects []setObject `json:"objects"`
+}
+
+type setObject struct {
+	Key   string `json:"key"`
+	Bytes int64  `json:"bytes"`
+	ETag  string `json:"etag,omitempty"`
+}
+
+// setObjectKey returns the key of the nth object, from 1, in a set.
+func setObjectKey(key string, n int) string {
+	return fmt.Sprintf("%s.part%04d", key, n)
+}
+
+// uploadSet uploads r as a set of objects of at most size bytes each, then
+// uploads a manifest listing them at key plus ".manifest".
+func uploadSet(m pipedream.MultipartUpload, r io.Reader, key string, size int64) error {
+	if !m.AdaptivePartSize && size > m.MaxPartSize*maxParts {
+		return fmt.Errorf("--split-size can be at most %s with %s parts", humanize.Bytes(uint64(m.MaxPartSize*maxParts)), humanize.Bytes(uint64(m.MaxPartSize)))
+	}
+
+	start := time.Now()
+	in := bufio.NewReader(r)
+	manifest := setManifest{Version: 1, Key: key}
+
+	if !silent {
+		fmt.Printf("%s Uploading in objects of up to %s...\n", arrow, humanize.Bytes(uint64(size)))
+	}
+
+	for n := 1; ; n++ {
+		// Stop once the input's done, rather than sending an empty object.
+		if _, err := in.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		objKey := setObjectKey(key, n)
+		objStart := time.Now()
+		c, err := sendComplete(m, io.LimitReader(in, size), objKey)
+		if err != nil {
+			return fmt.Errorf("could not upload %s: %v", objKey, err)
+		}
+		s := c.Summary
+		obj := setObject{Key: objKey, Bytes: s.Bytes}
+		if c.Result != nil {
+			obj.ETag = strings.Trim(aws.StringValue(c.Result.ETag), `"`)
+		}
+		manifest.Objects = append(manifest.Objects, obj)
+		manifest.Bytes += s.Bytes
+
+		if !silent {
+			details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(s.Bytes)), time.Since(objStart).Round(time.Millisecond))
+			fmt.Printf("%s %s %s\n", check, objKey, subtle(details))
+		}
+	}
+
+	// The manifest goes up last, so a set without one is known to be
+	// incomplete.
+	manifest.Created = time.Now().UTC()
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	m.Size = int64(len(b))
+	if _, err := sendReader(m, bytes.NewReader(b), key+manifestSuffix); err != nil {
+		return fmt.Errorf("could not upload manifest: %v", err)
+	}
+
+	if !silent {
+		fmt.Printf("%s Done. Sent %s in %d %s in %s.\n", check, humanize.Bytes(uint64(manifest.Bytes)), len(manifest.Objects), plural(len(manifest.Objects), "object", "objects"), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// splitAtLimit reports whether input too big for one upload should be split
+// into an object set, with --part-limit=split.
+func splitAtLimit() bool {
+	return strings.ToLower(partLimit) == "split"
+}
+
+// stdinSize returns the size of the input, if it's known, from
+// --expected-size, --from or stdin being a file.
+func stdinSize(m pipedream.MultipartUpload, stdin io.Reader) int64 {
+	if m.Size > 0 {
+		return m.Size
+	}
+	if stdin != io.Reader(os.Stdin) {
+		return 0
+	}
+	info, err := os.Stdin.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// pingTimeout is how long a ping can take before we give up on it.
+const pingTimeout = 10 * time.Second
+
+// pingTries is how many times to try a ping. Missing one could set off a
+// false alarm, or fail to set off a real one.
+const pingTries = 3
+
+var pingURL string
+
+// pingCheck is the check to ping with --ping-url, as with healthchecks.io: its
+// /start when an upload begins, itself when it succeeds and its /fail when it
+// doesn't.
+var pingCheck *url.URL
+
+// parsePingURL parses --ping-url.
+func parsePingURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("bad --ping-url %q; it must be an http or https URL", s)
+	}
+	return u, nil
+}
+
+// pingStart tells the check an upload has begun, so it can tell how long
+// uploads take and when one has hung.
+func pingStart() {
+	if pingCheck == nil {
+		return
+	}
+	if err := ping("/start", ""); err != nil {
+		fmt.Fprintf(os.Stderr, "%s could not ping %s: %v\n", ex, pingCheck.Host, err)
+	}
+}
+
+// pingResult tells the check how an upload went, with its details.
+func pingResult(r runResult) {
+	if pingCheck == nil {
+		return
+	}
+	endpoint := ""
+	if r.Err != nil {
+		endpoint = "/fail"
+	}
+	if err := ping(endpoint, r.details()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s could not ping %s: %v\n", ex, pingCheck.Host, err)
+	}
+}
+
+// ping posts body to endpoint under the check's URL, trying again if it
+// fails.
+func ping(endpoint, body string) error {
+	u := *pingCheck
+	u.Path = strings.TrimSuffix(u.Path, "/") + endpoint
+	client := &http.Client{Timeout: pingTimeout}
+
+	var err error
+	for try := 1; try <= pingTries; try++ {
+		if try > 1 {
+			time.Sleep(time.Duration(try-1) * time.Second)
+		}
+		var res *http.Response
+		res, err = client.Post(u.String(), "text/plain; charset=utf-8", strings.NewReader(body))
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= 200 && res.StatusCode <= 299 {
+			return nil
+		}
+		err = fmt.Errorf("got %s", res.Status)
+		if res.StatusCode < 500 {
+			// Trying again won't help.
+			break
+		}
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// gzipStream compresses r with gzip as it's read. If reading r fails, so does
+// reading the result.
+func gzipStream(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// filterStream pipes r through a shell command, such as one that encrypts,
+// returning the command's output. kill stops the command, for when the output
+// won't be read to the end.
+func filterStream(r io.Reader, command string) (out io.Reader, kill func(), err error) {
+	return pipeThrough(r, shellCommand(command))
+}
+
+// gpgEncrypt pipes r through gpg, encrypting it to the given recipients, as
+// with filterStream. The recipients' public keys need to be in the keyring
+// already.
+func gpgEncrypt(r io.Reader, recipients []string) (out io.Reader, kill func(), err error) {
+	args := []string{"--batch", "--no-tty", "--quiet", "--encrypt", "--output", "-"}
+	for _, rcpt := range recipients {
+		args = append(args, "--recipient", rcpt)
+	}
+	out, kill, err = pipeThrough(r, exec.Command("gpg", args...))
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		return nil, nil, errors.New("could not run gpg; is it installed?")
+	}
+	return out, kill, err
+}
+
+// newGPGDecrypter returns a filterWriter that decrypts what's written to it
+// with gpg, writing the result to w. The private key needs to be in the
+// keyring already, and usable without a prompt.
+func newGPGDecrypter(w io.Writer) *filterWriter {
+	return newFilterWriter(w, "could not decrypt", func(r io.Reader, w io.Writer) error {
+		c := exec.Command("gpg", "--batch", "--no-tty", "--quiet", "--decrypt")
+		c.Stdin, c.Stdout, c.Stderr = r, w, os.Stderr
+		err := c.Run()
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return errors.New("could not run gpg; is it installed?")
+		}
+		return err
+	})
+}
+
+// pipeThrough starts c with r as its input and returns its output.
+//
+// A command only sees the end of its input, not why it ended, so it would
+// happily finish on a truncated one. The output therefore fails, in place of
+// io.EOF, if reading r failed or the command did.
+func pipeThrough(r io.Reader, c *exec.Cmd) (out io.Reader, kill func(), err error) {
+	var inErr error
+	c.Stderr = os.Stderr
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, nil, err
+	}
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		if _, err := io.Copy(stdin, r); err != nil {
+			inErr = err
+		}
+		stdin.Close()
+	}()
+
+	kill = func() {
+		_ = c.Process.Kill()
+		_ = c.Wait()
+	}
+	out = &checkedReader{
+		r: &commandOutput{r: stdout, cmd: c},
+		check: func() error {
+			<-copied
+			return inErr
+		},
+	}
+	return out, kill, nil
+}
+
+// checkedReader reads r, and at the end of it returns the error from check,
+// if there is one, in place of io.EOF.
+type checkedReader struct {
+	r     io.Reader
+	check func() error
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		if checkErr := c.check(); checkErr != nil {
+			return n, checkErr
+		}
+	}
+	return n, err
+}
+
+// encryptionFlag returns the flag being used to encrypt uploads, if any. Only
+// one way of encrypting can be used at a time.
+func encryptionFlag() (string, error) {
+	switch {
+	case len(gpgRecipients) > 0 && len(ageRecipients) > 0:
+		return "", errors.New("--gpg-recipient and --age-recipient can't be used together")
+	case len(gpgRecipients) > 0:
+		return "--gpg-recipient", nil
+	case len(ageRecipients) > 0:
+		return "--age-recipient", nil
+	}
+	return "", nil
+}
+
+// filterWriter runs what's written to it through a filter, such as one that
+// decrypts or decompresses, which writes the result to another writer. Close
+// must be called to finish filtering and find out whether it worked.
+type filterWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+	err  error
+}
+
+// newFilterWriter starts filter writing to w. Its errors are prefixed with
+// what, such as "could not decrypt", unless they came from writing to w, in
+// which case they're the next filter's and say so themselves.
+func newFilterWriter(w io.Writer, what string, filter func(r io.Reader, w io.Writer) error) *filterWriter {
+	pr, pw := io.Pipe()
+	f := &filterWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		ew := &errWriter{w: w}
+		err := filter(pr, ew)
+		if err != nil && err != ew.err {
+			err = fmt.Errorf("%s: %v", what, err)
+		}
+		// Stop any more writes, so a failure isn't left blocking them.
+		pr.CloseWithError(err)
+		f.done <- err
+	}()
+	return f
+}
+
+func (f *filterWriter) Write(p []byte) (int, error) {
+	return f.pw.Write(p)
+}
+
+func (f *filterWriter) Close() error {
+	if f.done != nil {
+		f.pw.Close()
+		f.err = <-f.done
+		f.done = nil
+	}
+	return f.err
+}
+
+// errWriter remembers the error writing to w failed with.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// gzipMagic is how gzip data starts.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// newGunzipper returns a filterWriter that decompresses what's written to it
+// if it's gzipped, as db uploads are by default, and passes it through as it
+// is otherwise.
+func newGunzipper(w io.Writer) *filterWriter {
+	return newFilterWriter(w, "could not decompress", func(r io.Reader, w io.Writer) error {
+		br := bufio.NewReader(r)
+		if head, _ := br.Peek(len(gzipMagic)); !bytes.Equal(head, gzipMagic) {
+			_, err := io.Copy(w, br)
+			return err
+		}
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, gz); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGunzipper(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+		err  string
+	}{
+		{"gzipped", gzipped(t, "hello"), "hello", ""},
+		{"plain", []byte("hello"), "hello", ""},
+		{"empty", nil, "", ""},
+		{"one byte", []byte{0x1f}, "\x1f", ""},
+		{"truncated", gzipped(t, "hello")[:12], "", "could not decompress: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			g := newGunzipper(&out)
+			// Write a byte at a time, so the magic is split across writes.
+			for i := range tt.in {
+				g.Write(tt.in[i : i+1])
+			}
+			err := g.Close()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneOlderThan string
+	pruneKeepMin   int
+	pruneDryRun    bool
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old backups",
+	Long: `Delete the uploads under --path that are older than --older-than, so old
+backups don't pile up:
+
+  pipedream prune -b backups -p db/ --older-than 30d --keep-min 5
+
+The newest --keep-min uploads are always kept, however old, so backups that
+have stopped working don't leave you with none at all. Object sets made with
+--split-size are kept or deleted as a whole. Use --dry-run to see what would
+be deleted first.
+
+Rather than by age, uploads rotated as with schedule can be pruned by giving
+the path they were made with and how many of each tier to keep:
+
+  pipedream prune -b backups -p 'db/{tier}/{timestamp}.sql.gz' --keep-daily 7`,
+	Args: cobra.NoArgs,
+	RunE: prune,
+}
+
+func init() {
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "delete uploads older than this, such as 30d or 12h")
+	pruneCmd.Flags().IntVar(&pruneKeepMin, "keep-min", 0, "always keep at least this many of the newest uploads")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "show what would be deleted without deleting anything")
+	rootCmd.AddCommand(pruneCmd)
+}
+
+// backup is an upload as far as pruning is concerned: a single object, or an
+// object set with its manifest.
+type backup struct {
+	key      string
+	keys     []string
+	bytes    int64
+	modified time.Time
+}
+
+func prune(cmd *cobra.Command, args []string) error {
+	if rotating() {
+		return pruneRotation(cmd)
+	}
+	if pruneOlderThan == "" {
+		return errors.New("missing --older-than")
+	}
+	age, err := parseAge(pruneOlderThan)
+	if err != nil {
+		return err
+	}
+	if pruneKeepMin < 0 {
+		return errors.New("--keep-min can't be negative")
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		// Pruning a whole bucket is rarely meant, and hard to undo.
+		return errors.New("missing path; use --path to say which uploads to prune")
+	}
+	cmd.SilenceUsage = true
+
+	backups, err := listBackups(m, remotePath)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+	var doomed []backup
+	for i, b := range backups {
+		if i >= pruneKeepMin && b.modified.Before(cutoff) {
+			doomed = append(doomed, b)
+		}
+	}
+	return deleteBackups(m, doomed, len(backups), "")
+}
+
+// pruneRotation prunes a rotation without uploading anything, as each upload
+// to it would.
+func pruneRotation(cmd *cobra.Command) error {
+	if pruneOlderThan != "" || pruneKeepMin > 0 {
+		return errors.New("--older-than and --keep-min can't be used with --keep-daily, --keep-weekly and --keep-monthly")
+	}
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path; use the --path the uploads were made with, such as db/{tier}/{timestamp}.sql.gz")
+	}
+	if err := checkRotation(remotePath); err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	return rotate(m, remotePath)
+}
+
+// listBackups returns the backups whose keys start with prefix, newest first.
+func listBackups(m pipedream.MultipartUpload, prefix string) ([]backup, error) {
+	objects, err := m.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not list objects: %v", err)
+	}
+	backups := groupBackups(objects)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modified.After(backups[j].modified)
+	})
+	return backups, nil
+}
+
+// deleteBackups deletes the doomed backups out of total, unless it's a dry
+// run, saying what it's doing. kind describes them, such as "daily", for the
+// summary.
+func deleteBackups(m pipedream.MultipartUpload, doomed []backup, total int, kind string) error {
+	var (
+		keys  []string
+		bytes int64
+	)
+	for _, b := range doomed {
+		keys = append(keys, b.keys...)
+		bytes += b.bytes
+		if !silent {
+			verb := "Deleting"
+			if pruneDryRun {
+				verb = "Would delete"
+			}
+			fmt.Printf("%s %s s3://%s/%s %s\n", arrow, verb, m.Bucket, b.key, subtle(fmt.Sprintf("%s, %s", humanize.Bytes(uint64(b.bytes)), humanize.Time(b.modified))))
+		}
+	}
+	uploads := plural(total, "upload", "uploads")
+	if kind != "" {
+		uploads = kind + " " + uploads
+	}
+	if pruneDryRun {
+		if !silent {
+			fmt.Printf("%s %d of %d %s would be deleted, freeing %s.\n", check, len(doomed), total, uploads, humanize.Bytes(uint64(bytes)))
+		}
+		return nil
+	}
+
+	if len(keys) > 0 {
+		if err := m.Delete(keys...); err != nil {
+			return fmt.Errorf("could not delete old uploads: %v", err)
+		}
+	}
+	if !silent {
+		fmt.Printf("%s Deleted %d of %d %s, freeing %s.\n", check, len(doomed), total, uploads, humanize.Bytes(uint64(bytes)))
+	}
+	return nil
+}
+
+// setObjectPattern matches the keys of the objects in an object set.
+var setObjectPattern = regexp.MustCompile(`^(.+)\.part\d{4}$`)
+
+// groupBackups groups objects into backups, putting the objects of each
+// object set together with its manifest. A set is as old as its manifest,
+// which is written last.
+func groupBackups(objects []pipedream.Object) []backup {
+	sets := map[string]bool{}
+	for _, o := range objects {
+		if strings.HasSuffix(o.Key, manifestSuffix) {
+			sets[strings.TrimSuffix(o.Key, manifestSuffix)] = true
+		}
+	}
+
+	byKey := map[string]*backup{}
+	var order []string
+	for _, o := range objects {
+		key := o.Key
+		if base := strings.TrimSuffix(key, manifestSuffix); base != key && sets[base] {
+			key = base
+		} else if match := setObjectPattern.FindStringSubmatch(key); match != nil && sets[match[1]] {
+			key = match[1]
+		}
+		b, ok := byKey[key]
+		if !ok {
+			b = &backup{key: key}
+			byKey[key] = b
+			order = append(order, key)
+		}
+		b.keys = append(b.keys, o.Key)
+		b.bytes += o.Size
+		if o.LastModified.After(b.modified) {
+			b.modified = o.LastModified
+		}
+	}
+
+	backups := make([]backup, len(order))
+	for i, k := range order {
+		backups[i] = *byKey[k]
+	}
+	return backups
+}
+
+// parseAge parses a duration like time.ParseDuration does, also allowing a
+// whole number of days, as in 30d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("could not parse age %q; use a duration like 30d or 12h", s)
+	}
+	return d, nil
+}
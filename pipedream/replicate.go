@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+var (
+	replicateTo     string
+	replicaEndpoint string
+	replicaRegion   string
+)
+
+// replicaOf returns where uploads with m are copied to with --replicate-to,
+// or nil if they aren't. It's the same as m apart from the bucket and, if
+// they're given, the endpoint and region.
+func replicaOf(m pipedream.MultipartUpload) (*pipedream.MultipartUpload, error) {
+	if replicateTo == "" {
+		if replicaEndpoint != "" || replicaRegion != "" {
+			return nil, errors.New("--replica-endpoint and --replica-region need --replicate-to")
+		}
+		return nil, nil
+	}
+	bucket, key, err := parseS3URL(replicateTo)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		return nil, fmt.Errorf("--replicate-to takes a bucket, such as s3://%s; the key is the same as the upload's", bucket)
+	}
+	r := m
+	r.Bucket = bucket
+	r.FailoverEndpoints = nil
+	if replicaEndpoint != "" {
+		r.Endpoint = replicaEndpoint
+	}
+	if replicaRegion != "" {
+		r.Region = replicaRegion
+	}
+	return &r, nil
+}
+
+// printReplicated reports how copying an upload to --replicate-to went.
+// Failures are always reported, since the upload itself succeeded and nothing
+// else will say so.
+func printReplicated(e pipedream.Replicated) {
+	if e.Err != nil {
+		fmt.Printf("%s Could not replicate %s %s\n", ex, e.Key, subtle(e.Err.Error()))
+		return
+	}
+	if !silent {
+		fmt.Printf("%s Replicated to s3://%s/%s\n", check, e.Bucket, e.Key)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [DEST]",
+	Short: "Download an upload, checking it on the way",
+	Long: `Download what was uploaded to --path, writing it to DEST or, if DEST is
+missing or "-", to stdout. Object sets made with --split-size are put back
+together from their manifest.
+
+Everything is checked as it arrives: sizes, ETags that are plain MD5s, and the
+SHA-256 pipedream stores when --skip-unchanged or --content-hash is used. If
+anything doesn't match the restore fails, and a DEST file is only put in place
+once everything has checked out.
+
+Uploads encrypted with --age-recipient are decrypted with --age-identity, and
+ones encrypted with --gpg-recipient with --gpg, after the encrypted objects
+have been checked. Anything gzipped, as db dumps
+are by default, is then decompressed, unless --no-decompress is given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: restore,
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&ageIdentity, "age-identity", "", "decrypt the upload with the age private keys in this file")
+	restoreCmd.Flags().BoolVar(&gpgDecrypt, "gpg", false, "decrypt the upload with gpg, using a private key in the keyring")
+	restoreCmd.Flags().BoolVar(&noDecompress, "no-decompress", false, "leave gzipped uploads compressed")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var (
+	gpgDecrypt   bool
+	noDecompress bool
+)
+
+func restore(cmd *cobra.Command, args []string) error {
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path")
+	}
+	if gpgDecrypt && ageIdentity != "" {
+		return errors.New("--gpg and --age-identity can't be used together")
+	}
+	var ids []age.Identity
+	if ageIdentity != "" {
+		if ids, err = readAgeIdentities(ageIdentity); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+
+	dest := "-"
+	if len(args) > 0 {
+		dest = args[0]
+	}
+
+	// Where there's a manifest there's an object set.
+	objects := []setObject{{Key: remotePath}}
+	var total int64 = -1
+	if body, _, err := m.Get(remotePath + manifestSuffix); err == nil {
+		var manifest setManifest
+		err := json.NewDecoder(body).Decode(&manifest)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("could not read manifest: %v", err)
+		}
+		objects = manifest.Objects
+		total = manifest.Bytes
+	}
+
+	var w io.Writer = os.Stdout
+	var tmp *os.File
+	if dest != "-" {
+		tmp, err = os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".restore-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		w = tmp
+	}
+
+	// What was done on the way up is undone in reverse: decrypt, then
+	// decompress. An object set is one stream cut into pieces, so this is
+	// done to what's been put back together.
+	var filters []*filterWriter
+	if !noDecompress {
+		filters = append(filters, newGunzipper(w))
+		w = filters[len(filters)-1]
+	}
+	switch {
+	case ids != nil:
+		filters = append(filters, newAgeDecrypter(w, ids))
+		w = filters[len(filters)-1]
+	case gpgDecrypt:
+		filters = append(filters, newGPGDecrypter(w))
+		w = filters[len(filters)-1]
+	}
+	defer func() {
+		for i := len(filters) - 1; i >= 0; i-- {
+			filters[i].Close()
+		}
+	}()
+
+	start := time.Now()
+	var written int64
+	for _, o := range objects {
+		n, err := restoreObject(m, o, w)
+		written += n
+		if err != nil {
+			return fmt.Errorf("could not restore %s: %v", o.Key, err)
+		}
+	}
+	if total >= 0 && written != total {
+		return fmt.Errorf("restored %d bytes but the manifest says %d", written, total)
+	}
+	// Finish with the outermost filter first, since it writes to the next.
+	for i := len(filters) - 1; i >= 0; i-- {
+		if err := filters[i].Close(); err != nil {
+			return fmt.Errorf("could not restore %s: %v", remotePath, err)
+		}
+	}
+
+	if tmp != nil {
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), dest); err != nil {
+			return err
+		}
+	}
+
+	if !silent {
+		// stdout may well be the data, so report on stderr.
+		fmt.Fprintf(os.Stderr, "%s Restored %s in %s.\n", check, humanize.Bytes(uint64(written)), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// restoreObject downloads an object to w, checking it against what's known
+// about it. It returns the number of bytes written.
+func restoreObject(m pipedream.MultipartUpload, want setObject, w io.Writer) (int64, error) {
+	body, o, err := m.Get(want.Key)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	// Some services report a different form of ETag once an upload is
+	// complete, so only compare like with like.
+	sameForm := strings.Contains(o.ETag, "-") == strings.Contains(want.ETag, "-")
+	if want.ETag != "" && sameForm && o.ETag != want.ETag {
+		return 0, fmt.Errorf("object has changed since it was uploaded: ETag is %s, expected %s", o.ETag, want.ETag)
+	}
+	if want.Bytes > 0 && o.Size != want.Bytes {
+		return 0, fmt.Errorf("object is %d bytes, expected %d", o.Size, want.Bytes)
+	}
+
+	md5sum, sha := md5.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, md5sum, sha), body)
+	if err != nil {
+		return n, err
+	}
+	if n != o.Size {
+		return n, fmt.Errorf("got %d bytes, expected %d", n, o.Size)
+	}
+
+	// ETags of multipart uploads depend on the part sizes, so only plain MD5
+	// ETags can be checked.
+	if !strings.Contains(o.ETag, "-") && len(o.ETag) == md5.Size*2 {
+		if err := checkSum("MD5", md5sum, o.ETag); err != nil {
+			return n, err
+		}
+	}
+	if hash := o.ContentHash(); hash != "" {
+		if err := checkSum("SHA-256", sha, hash); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func checkSum(name string, h hash.Hash, want string) error {
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("%s mismatch: got %s, expected %s", name, got, want)
+	}
+	return nil
+}
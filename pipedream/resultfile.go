@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// resultFile is where --result-file writes a record of the last run.
+var resultFile string
+
+// resultRecord is what's written to --result-file, for monitoring to check
+// that backups are still happening.
+type resultRecord struct {
+	Status   string    `json:"status"`
+	Target   string    `json:"target"`
+	Key      string    `json:"key,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	ETag     string    `json:"etag,omitempty"`
+	Checksum string    `json:"checksum,omitempty"`
+	Time     time.Time `json:"timestamp"`
+	Duration float64   `json:"duration_seconds"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// uploadChecksums returns the ETag of a completed upload, and the checksum S3
+// worked out for it, if a checksum algorithm was used.
+func uploadChecksums(r *s3.CompleteMultipartUploadOutput) (etag, checksum string) {
+	if r == nil {
+		return "", ""
+	}
+	for _, sum := range []*string{r.ChecksumCRC32, r.ChecksumCRC32C, r.ChecksumSHA1, r.ChecksumSHA256} {
+		if sum != nil {
+			checksum = *sum
+		}
+	}
+	return strings.Trim(aws.StringValue(r.ETag), `"`), checksum
+}
+
+// writeResultFile records the result in --result-file. The file is replaced
+// in one go, so anything reading it never sees half a record. Failing to
+// write it is reported, but doesn't fail the run.
+func writeResultFile(r runResult) {
+	if resultFile == "" {
+		return
+	}
+	rec := resultRecord{
+		Status:   "success",
+		Target:   r.Target,
+		Key:      r.Key,
+		Bytes:    r.Bytes,
+		ETag:     r.ETag,
+		Checksum: r.Checksum,
+		Time:     time.Now().UTC(),
+		Duration: r.Duration.Seconds(),
+	}
+	if r.Err != nil {
+		rec.Status = "failure"
+		rec.Error = r.Err.Error()
+	}
+	if err := replaceFile(resultFile, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "%s could not write result file: %v\n", ex, err)
+	}
+}
+
+// replaceFile writes v as JSON to a temporary file next to path, then renames
+// it over path.
+func replaceFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isS3URL reports whether s is an s3:// URL rather than a local path.
+func isS3URL(s string) bool {
+	return strings.HasPrefix(s, "s3://")
+}
+
+// parseS3URL splits an s3://bucket/key URL into its bucket and key. The key
+// may be empty.
+func parseS3URL(s string) (bucket, key string, err error) {
+	if !isS3URL(s) {
+		return "", "", fmt.Errorf("%q isn't an s3:// URL", s)
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(s, "s3://"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%q is missing a bucket", s)
+	}
+	return bucket, key, nil
+}
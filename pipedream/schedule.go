@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cronExpr string
+	execCmd  string
+	runNow   bool
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run a command on a schedule and upload its output",
+	Long: `Run a shell command on a cron schedule and upload what it writes to
+stdout. If the command fails the upload is aborted, so a broken dump is never
+mistaken for a good one. The command is run by bash with pipefail set, so a
+pipeline like the one below fails if pg_dump does, not just if gzip does;
+without bash it's run by sh, where only the last command in a pipeline counts.
+
+  pipedream schedule --cron "0 3 * * *" --exec "pg_dump mydb | gzip" \
+    -b backups -p 'db/{timestamp}.sql.gz'
+
+The schedule is in local time. The path can contain the same placeholders as
+with listen: {n}, {timestamp}, {date} and {unix}. With --latest each upload is
+also copied to the path with its placeholders replaced by "latest", such as
+db/latest.sql.gz, for restore scripts to fetch.
+
+To keep a grandfather-father-son rotation, put {tier} in the path, which is
+monthly on the 1st, weekly on Sundays and daily otherwise, and say how many of
+each to keep:
+
+  pipedream schedule --cron "0 3 * * *" --exec "pg_dump mydb | gzip" \
+    -b backups -p 'db/{tier}/{timestamp}.sql.gz' \
+    --keep-daily 7 --keep-weekly 4 --keep-monthly 12
+
+After each upload the oldest in each tier beyond those numbers are deleted.`,
+	Args: cobra.NoArgs,
+	RunE: schedule,
+}
+
+func init() {
+	scheduleCmd.Flags().StringVar(&cronExpr, "cron", "", "when to run, as a five-field cron expression")
+	scheduleCmd.Flags().StringVar(&execCmd, "exec", "", "the shell command whose output to upload")
+	scheduleCmd.Flags().BoolVar(&runNow, "now", false, "also run once right away")
+	rootCmd.AddCommand(scheduleCmd)
+}
+
+func schedule(cmd *cobra.Command, args []string) error {
+	if cronExpr == "" {
+		return errors.New("missing --cron")
+	}
+	if execCmd == "" {
+		return errors.New("missing --exec")
+	}
+	sched, err := parseCron(cronExpr)
+	if err != nil {
+		return err
+	}
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path")
+	}
+	if latest {
+		if _, err := latestKey(remotePath); err != nil {
+			return err
+		}
+	}
+	if err := checkRotation(remotePath); err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	n := 1
+	if runNow {
+		runScheduled(m, n)
+		n++
+	}
+	for ; ; n++ {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("cron expression %q never matches", cronExpr)
+		}
+		if !silent {
+			fmt.Printf("%s Next run at %s\n", arrow, next.Format(time.RFC1123))
+		}
+		time.Sleep(time.Until(next))
+		runScheduled(m, n)
+	}
+}
+
+// runScheduled runs the command once and uploads its output. Failures are
+// reported, but don't stop the schedule.
+func runScheduled(m pipedream.MultipartUpload, n int) {
+	start := time.Now()
+	key := expandKey(remotePath, n, start)
+	pingStart()
+
+	c, err := uploadCommand(m, execCmd, key)
+	notify(uploadResult(m, key, start, c, err))
+	if err != nil {
+		fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+		return
+	}
+	if !silent {
+		details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(c.Summary.Bytes)), time.Since(start).Round(time.Millisecond))
+		fmt.Printf("%s %s %s\n", check, key, subtle(details))
+	}
+	if latest {
+		if err := pointLatest(m, remotePath, key); err != nil {
+			fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+		}
+	}
+	if rotating() {
+		if err := rotate(m, remotePath); err != nil {
+			fmt.Printf("%s %s %s\n", ex, key, subtle(err.Error()))
+		}
+	}
+}
+
+// uploadCommand runs a shell command and uploads its stdout to key, returning the
+// upload's Complete event.
+func uploadCommand(m pipedream.MultipartUpload, command, key string) (pipedream.Complete, error) {
+	c := shellCommand(command)
+	c.Stderr = os.Stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return pipedream.Complete{}, err
+	}
+	if err := c.Start(); err != nil {
+		return pipedream.Complete{}, err
+	}
+
+	done, err := sendComplete(m, &commandOutput{r: stdout, cmd: c}, key)
+	if err != nil {
+		// Make sure the command isn't left running, or blocked writing to a
+		// pipe nobody's reading.
+		_ = c.Process.Kill()
+		_ = c.Wait()
+	}
+	return done, err
+}
+
+// shellCommand returns a command that runs command in bash with pipefail
+// set, so a pipeline fails if any part of it does, or in sh if there's no
+// bash.
+func shellCommand(command string) *exec.Cmd {
+	if _, err := exec.LookPath("bash"); err == nil {
+		return exec.Command("bash", "-o", "pipefail", "-c", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// commandOutput reads the output of a command. At the end of the output it
+// waits for the command to exit and returns an error in place of io.EOF if it
+// failed, which aborts the upload.
+type commandOutput struct {
+	r    io.Reader
+	cmd  *exec.Cmd
+	done bool
+}
+
+func (c *commandOutput) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF && !c.done {
+		c.done = true
+		if werr := c.cmd.Wait(); werr != nil {
+			return n, fmt.Errorf("command failed: %v", werr)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellCommandPipefail(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("no bash")
+	}
+	if err := shellCommand("false | cat").Run(); err == nil {
+		t.Error("a pipeline whose first command failed succeeded")
+	}
+	if err := shellCommand("true | cat").Run(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/babyenv"
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var listenAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Accept uploads over HTTP and stream them to the bucket",
+	Long: `Run an HTTP server which streams the body of each PUT /bucket/key request
+straight into a multipart upload, so machines without storage credentials can
+still upload. Requests must carry the token in AUTH_TOKEN as a bearer token:
+
+  curl -T dump.rdb -H "Authorization: Bearer $AUTH_TOKEN" http://host:8080/backups/dump.rdb
+
+If --bucket is given, only that bucket can be uploaded to.`,
+	Args: cobra.NoArgs,
+	RunE: serve,
+}
+
+func init() {
+	serveCmd.Flags().StringVarP(&listenAddr, "listen", "l", ":8080", "the address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+type serveConfig struct {
+	AuthToken string `env:"AUTH_TOKEN"`
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	var cfg serveConfig
+	if err := babyenv.Parse(&cfg); err != nil {
+		return fmt.Errorf("Could not parse config: %v", err)
+	}
+	if cfg.AuthToken == "" {
+		return errors.New("missing AUTH_TOKEN")
+	}
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	if !silent {
+		fmt.Printf("%s Listening on %s...\n", arrow, listenAddr)
+	}
+	srv := &http.Server{
+		Addr: listenAddr,
+		Handler: &gateway{
+			upload: m,
+			token:  cfg.AuthToken,
+		},
+		// Bodies are streamed for as long as uploads take, so there's no
+		// limit on reading or writing them, only on clients that connect and
+		// then never get as far as sending one.
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	return srv.ListenAndServe()
+}
+
+// gateway is an http.Handler that streams request bodies into uploads.
+type gateway struct {
+	upload pipedream.MultipartUpload
+	token  string
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		httpError(w, http.StatusMethodNotAllowed, "only PUT is supported")
+		return
+	}
+
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		httpError(w, http.StatusBadRequest, "path must be /bucket/key")
+		return
+	}
+	if g.upload.Bucket != "" && bucket != g.upload.Bucket {
+		httpError(w, http.StatusForbidden, fmt.Sprintf("uploads to %s aren't allowed", bucket))
+		return
+	}
+
+	// Each request gets its own copy of the upload.
+	m := g.upload
+	m.Bucket = bucket
+	if r.ContentLength > 0 {
+		m.Size = r.ContentLength
+	}
+
+	start := time.Now()
+	ch, err := m.StartContext(r.Context(), r.Body, key)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	metrics.started()
+	stats.started()
+	for e := range ch {
+		metrics.observe(e)
+		stats.observe(e)
+		events.write(key, e)
+
+		switch e := e.(type) {
+		case pipedream.Complete:
+			catalog.record(m, key, e)
+			if !silent {
+				details := fmt.Sprintf("%s in %s", humanize.Bytes(uint64(e.Bytes)), time.Since(start).Round(time.Millisecond))
+				fmt.Printf("%s %s %s/%s %s\n", check, r.RemoteAddr, bucket, key, subtle(details))
+			}
+			res := map[string]interface{}{
+				"bucket": bucket,
+				"key":    key,
+				"bytes":  e.Bytes,
+			}
+			if e.Result != nil && e.Result.ETag != nil {
+				res["etag"] = *e.Result.ETag
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		case pipedream.Error, pipedream.Aborted:
+			fmt.Printf("%s %s %s/%s %s\n", ex, r.RemoteAddr, bucket, key, subtle(e.(error).Error()))
+			httpError(w, http.StatusBadGateway, e.(error).Error())
+			return
+		}
+	}
+}
+
+// authorized reports whether a request carries the right bearer token.
+func (g *gateway) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && hmac.Equal([]byte(token), []byte(g.token))
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var statJSON bool
+
+var statCmd = &cobra.Command{
+	Use:   "stat",
+	Short: "Show the details of an uploaded object",
+	Long: `Show the size, ETag, content type, storage class, last modified time and
+metadata of the object at --path, without downloading it.`,
+	Args: cobra.NoArgs,
+	RunE: stat,
+}
+
+func init() {
+	statCmd.Flags().BoolVar(&statJSON, "json", false, "print the details as JSON")
+	rootCmd.AddCommand(statCmd)
+}
+
+// statJSONOutput is how stat --json describes an object.
+type statJSONOutput struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"content_type"`
+	StorageClass string            `json:"storage_class"`
+	LastModified time.Time         `json:"last_modified"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+func stat(cmd *cobra.Command, args []string) error {
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	if remotePath == "" {
+		return errors.New("missing path")
+	}
+	cmd.SilenceUsage = true
+
+	obj, err := m.Stat(remotePath)
+	if isNotFound(err) {
+		return fmt.Errorf("s3://%s/%s doesn't exist", m.Bucket, remotePath)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get details of s3://%s/%s: %v", m.Bucket, remotePath, err)
+	}
+
+	if statJSON {
+		out := statJSONOutput{
+			Bucket:       m.Bucket,
+			Key:          obj.Key,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			ContentType:  obj.ContentType,
+			StorageClass: obj.StorageClass,
+			LastModified: obj.LastModified,
+			Metadata:     obj.Metadata,
+		}
+		if out.Metadata == nil {
+			out.Metadata = map[string]string{}
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	row := func(name, value string) {
+		fmt.Printf("  %-15s %s\n", subtle(name), value)
+	}
+	fmt.Printf("s3://%s/%s\n", m.Bucket, obj.Key)
+	row("Size", fmt.Sprintf("%s (%d bytes)", humanize.Bytes(uint64(obj.Size)), obj.Size))
+	row("ETag", obj.ETag)
+	row("Content type", obj.ContentType)
+	row("Storage class", obj.StorageClass)
+	row("Last modified", obj.LastModified.Local().Format("2006-01-02 15:04:05 MST"))
+	keys := make([]string, 0, len(obj.Metadata))
+	for k := range obj.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		name := ""
+		if i == 0 {
+			name = "Metadata"
+		}
+		row(name, k+": "+obj.Metadata[k])
+	}
+	return nil
+}
+
+// isNotFound reports whether err is S3 saying there's no such object.
+func isNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// statsdSink sends upload stats to a statsd (or DogStatsD) server over UDP.
+// Like uploadMetrics, a nil *statsdSink does nothing.
+type statsdSink struct {
+	mtx    sync.Mutex
+	conn   net.Conn
+	prefix string
+}
+
+// stats is set when --statsd-addr is given.
+var stats *statsdSink
+
+// dialStatsd sets up the statsd sink. Since statsd is UDP nothing is actually
+// sent here, so an address with nothing listening isn't an error.
+func dialStatsd(addr, prefix string) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	stats = &statsdSink{conn: conn, prefix: prefix}
+	return nil
+}
+
+func (s *statsdSink) count(name string, n int64) {
+	s.send(fmt.Sprintf("%s%s:%d|c", s.prefix, name, n))
+}
+
+func (s *statsdSink) timing(name string, d time.Duration) {
+	s.send(fmt.Sprintf("%s%s:%d|ms", s.prefix, name, d.Milliseconds()))
+}
+
+func (s *statsdSink) gauge(name string, delta int64) {
+	s.send(fmt.Sprintf("%s%s:%+d|g", s.prefix, name, delta))
+}
+
+// send writes a single metric. Stats are best-effort, so errors are dropped.
+func (s *statsdSink) send(line string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, _ = s.conn.Write([]byte(line))
+}
+
+// started records the start of an upload.
+func (s *statsdSink) started() {
+	if s == nil {
+		return
+	}
+	s.gauge("uploads.active", 1)
+}
+
+// observe records an upload event.
+func (s *statsdSink) observe(e pipedream.Event) {
+	if s == nil {
+		return
+	}
+	switch e := e.(type) {
+	case pipedream.Progress:
+		s.count("bytes", int64(e.Bytes))
+		s.count("parts", int64(e.Parts))
+	case pipedream.Timing:
+		s.timing("part.read", e.ReadTime)
+		s.timing("part.wait", e.WaitTime)
+		s.timing("part.network", e.NetworkTime)
+	case pipedream.Retry:
+		s.count("retries", 1)
+	case pipedream.Complete:
+		s.gauge("uploads.active", -1)
+		s.count("uploads.success", 1)
+	case pipedream.Error, pipedream.Aborted:
+		s.gauge("uploads.active", -1)
+		s.count("uploads.failure", 1)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+)
+
+// summaryReport is the end-of-run summary printed with --summary json. When
+// uploading files it covers all of them.
+type summaryReport struct {
+	Files      int     `json:"files,omitempty"`
+	Failed     int     `json:"failed,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	Parts      int     `json:"parts"`
+	Retries    int     `json:"retries"`
+	Duration   float64 `json:"duration_seconds"`
+	Throughput float64 `json:"throughput"`
+	URL        string  `json:"url,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// add adds the totals from a finished upload to the report.
+func (r *summaryReport) add(s pipedream.Summary) {
+	r.Bytes += s.Bytes
+	r.Parts += s.Parts
+	r.Retries += s.Retries
+}
+
+// finish sets the duration of the run and the resulting throughput.
+func (r *summaryReport) finish(d time.Duration) {
+	r.Duration = d.Seconds()
+	if r.Duration > 0 {
+		r.Throughput = float64(r.Bytes) / r.Duration
+	}
+}
+
+// print writes the report to stdout as JSON.
+func (r summaryReport) print() {
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not encode summary: %v\n", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// jsonSummary reports whether --summary json was given.
+func jsonSummary() bool {
+	return summaryFormat == "json"
+}
+
+// describeSummary returns the details of a summary for humans.
+func describeSummary(parts, retries int, throughput float64) string {
+	s := fmt.Sprintf("%d %s, %s/s", parts, plural(parts, "part", "parts"), humanize.Bytes(uint64(throughput)))
+	switch retries {
+	case 0:
+		s += ", no retries"
+	default:
+		s += fmt.Sprintf(", %d %s", retries, plural(retries, "retry", "retries"))
+	}
+	return s
+}
+
+// skippedMessage says why an upload was skipped.
+func skippedMessage() string {
+	if ifNotExists != "" {
+		return "It already exists, so it was skipped."
+	}
+	return "Unchanged since the last upload, so it was skipped."
+}
+
+// skippedDetails is skippedMessage for the line printed for each file.
+func skippedDetails() string {
+	if ifNotExists != "" {
+		return "already exists, skipped"
+	}
+	return "unchanged, skipped"
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
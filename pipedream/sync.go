@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/meowgorithm/pipedream"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDelete   bool
+	syncDryRun   bool
+	syncChecksum bool
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync DIR s3://BUCKET[/PREFIX]",
+	Short: "Upload the files in a directory that have changed",
+	Long: `Upload the files in a directory that are missing from the bucket or have
+changed since they were last uploaded. A file has changed if its size differs
+or it was modified after the object was uploaded; with --checksum its ETag is
+compared instead of its modification time, which reads every file.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSync,
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "delete objects under the prefix which don't exist locally")
+	syncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "n", false, "show what would be done without doing it")
+	syncCmd.Flags().BoolVarP(&syncChecksum, "checksum", "c", false, "compare ETags rather than modification times")
+	rootCmd.AddCommand(syncCmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	dir := args[0]
+	b, prefix, err := parseS3URL(args[1])
+	if err != nil {
+		return err
+	}
+	bucket = b
+
+	m, err := newUpload(cmd)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	if err := startReporting(); err != nil {
+		return err
+	}
+
+	local, err := walkSyncDir(dir, prefix)
+	if err != nil {
+		return err
+	}
+
+	// Don't let a prefix of "logs" pick up "logs-old/".
+	listPrefix := prefix
+	if listPrefix != "" && !strings.HasSuffix(listPrefix, "/") {
+		listPrefix += "/"
+	}
+	objects, err := m.List(listPrefix)
+	if err != nil {
+		return fmt.Errorf("could not list %s: %v", args[1], err)
+	}
+	remote := make(map[string]pipedream.Object, len(objects))
+	for _, o := range objects {
+		remote[o.Key] = o
+	}
+
+	var changed []localFile
+	seen := make(map[string]bool, len(local))
+	for _, f := range local {
+		seen[f.key] = true
+		ok, err := needsSync(m, f, remote)
+		if err != nil {
+			return err
+		}
+		if ok {
+			changed = append(changed, f)
+		}
+	}
+
+	var stale []string
+	if syncDelete {
+		for _, o := range objects {
+			if !seen[o.Key] {
+				stale = append(stale, o.Key)
+			}
+		}
+	}
+
+	if syncDryRun {
+		for _, f := range changed {
+			fmt.Printf("%s Would upload %s %s %s\n", arrow, f.path, arrow, f.key)
+		}
+		for _, k := range stale {
+			fmt.Printf("%s Would delete %s\n", arrow, k)
+		}
+		return nil
+	}
+
+	if len(changed) == 0 && len(stale) == 0 {
+		if !silent {
+			fmt.Printf("%s Everything's up to date.\n", check)
+		}
+		return nil
+	}
+
+	if len(changed) > 0 {
+		if err := uploadFiles(m, changed); err != nil {
+			// Don't delete anything if the local copy didn't make it up.
+			return err
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := m.Delete(stale...); err != nil {
+			return fmt.Errorf("could not delete stale objects: %v", err)
+		}
+		if !silent {
+			fmt.Printf("%s Deleted %d %s.\n", check, len(stale), plural(len(stale), "object", "objects"))
+		}
+	}
+	return nil
+}
+
+// walkSyncDir lists the files in dir with the keys they sync to. Unlike
+// uploading a directory, the directory's own name isn't part of the key.
+func walkSyncDir(dir, prefix string) ([]localFile, error) {
+	var files []localFile
+	root := filepath.Clean(dir)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{
+			path:    p,
+			key:     joinKey(prefix, filepath.ToSlash(rel)),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// needsSync reports whether a local file is missing from the bucket or
+// differs from its copy there.
+func needsSync(m pipedream.MultipartUpload, f localFile, remote map[string]pipedream.Object) (bool, error) {
+	o, ok := remote[f.key]
+	if !ok || o.Size != f.size {
+		return true, nil
+	}
+	if !syncChecksum {
+		return f.modTime.After(o.LastModified), nil
+	}
+
+	r, err := os.Open(f.path)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	// Services that don't follow S3's multipart scheme give every object a
+	// plain MD5 for an ETag, however it was uploaded.
+	var etag string
+	if strings.Contains(o.ETag, "-") {
+		etag, err = m.ETag(r)
+	} else {
+		h := md5.New()
+		_, err = io.Copy(h, r)
+		etag = hex.EncodeToString(h.Sum(nil))
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read %s: %v", f.path, err)
+	}
+	return etag != o.ETag, nil
+}
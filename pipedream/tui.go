@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dustin/go-humanize"
+	"github.com/meowgorithm/pipedream"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+const (
+	// tuiParts is how many of the most recent parts get a bar of their own.
+	tuiParts = 6
+
+	// tuiHeartbeat is how often the bar for the part being sent is updated,
+	// unless --heartbeat says otherwise.
+	tuiHeartbeat = 200 * time.Millisecond
+
+	maxBarWidth   = 40
+	maxGraphWidth = 40
+)
+
+var (
+	sparks  = []rune("▁▂▃▄▅▆▇█")
+	warning = termenv.Style{}.Foreground(color("214")).Styled
+)
+
+// tui shows an upload's progress live with Bubble Tea: a bar for each
+// recent part, one for the whole upload, a graph of the throughput and the
+// retries so far. Events are handed to it with send as they arrive.
+type tui struct {
+	program *tea.Program
+	events  chan pipedream.Event
+	done    chan struct{}
+	err     error
+}
+
+// startTUI starts the TUI for an upload to path. Keyboard input is read from
+// the terminal, since stdin is the data being uploaded. Pressing q or ctrl+c
+// calls cancel.
+func startTUI(path string, cancel func() error) (*tui, error) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, errors.New("--tui needs stdout to be a terminal")
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("--tui needs a terminal: %v", err)
+	}
+
+	t := &tui{
+		events: make(chan pipedream.Event),
+		done:   make(chan struct{}),
+	}
+	model := tuiModel{
+		path:   path,
+		events: t.events,
+		cancel: cancel,
+		bar:    progress.New(progress.WithDefaultGradient()),
+		width:  80,
+	}
+	t.program = tea.NewProgram(model, tea.WithInput(tty))
+	go func() {
+		defer close(t.done)
+		defer tty.Close()
+		t.err = t.program.Start()
+	}()
+	return t, nil
+}
+
+// send passes an event to the TUI. If the TUI has already gone the event is
+// dropped.
+func (t *tui) send(e pipedream.Event) {
+	select {
+	case t.events <- e:
+	case <-t.done:
+	}
+}
+
+// close tells the TUI there'll be no more events and waits for it to draw
+// the outcome and exit.
+func (t *tui) close() error {
+	close(t.events)
+	<-t.done
+	return t.err
+}
+
+// tuiEventMsg carries an event from the upload to the model.
+type tuiEventMsg struct {
+	event pipedream.Event
+}
+
+// tuiDoneMsg says there are no more events.
+type tuiDoneMsg struct{}
+
+// waitForEvent returns a command that waits for the next event.
+func waitForEvent(events <-chan pipedream.Event) tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-events
+		if !ok {
+			return tuiDoneMsg{}
+		}
+		return tuiEventMsg{e}
+	}
+}
+
+// tuiPart is the state of a part as shown in the TUI.
+type tuiPart struct {
+	number  int
+	sent    int64
+	size    int64
+	retries int
+	done    bool
+}
+
+type tuiModel struct {
+	path   string
+	events <-chan pipedream.Event
+	cancel func() error
+	bar    progress.Model
+	width  int
+
+	parts      []tuiPart
+	rates      []float64 // the throughput of each part, in bytes per second
+	sent       int64
+	size       int64
+	rate       float64
+	eta        time.Duration
+	elapsed    time.Duration
+	retries    int
+	cancelling bool
+
+	// Set once the upload's over.
+	finished bool
+	complete *pipedream.Complete
+	failure  string
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return waitForEvent(m.events)
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			// Keep going until the upload's been aborted, so nothing is
+			// left behind.
+			if !m.finished && !m.cancelling {
+				m.cancelling = true
+				go m.cancel()
+			}
+		}
+		return m, nil
+
+	case tuiDoneMsg:
+		m.finished = true
+		return m, tea.Quit
+
+	case tuiEventMsg:
+		m.observe(msg.event)
+		return m, waitForEvent(m.events)
+	}
+	return m, nil
+}
+
+// observe updates the model with an event from the upload.
+func (m *tuiModel) observe(e pipedream.Event) {
+	switch e := e.(type) {
+	case pipedream.Heartbeat:
+		p := m.part(e.PartNumber)
+		p.sent = e.InFlight
+		p.size = e.PartSize
+	case pipedream.Retry:
+		p := m.part(e.PartNumber)
+		p.retries++
+		p.sent = 0
+		m.retries++
+	case pipedream.Progress:
+		p := m.part(e.PartNumber)
+		p.sent = int64(e.Bytes)
+		p.size = int64(e.Bytes)
+		p.done = true
+		if d := e.Elapsed - m.elapsed; d > 0 {
+			m.rates = append(m.rates, float64(e.Bytes)/d.Seconds())
+		}
+		m.elapsed = e.Elapsed
+		m.sent = e.Sent
+		m.size = e.Size
+		m.rate = e.Rate
+		m.eta = e.ETA
+	case pipedream.Failover:
+		// Starting over somewhere else, so the parts sent so far don't
+		// count.
+		m.parts, m.rates = nil, nil
+		m.sent, m.rate, m.eta, m.elapsed = 0, 0, 0, 0
+	case pipedream.Complete:
+		m.finished = true
+		m.complete = &e
+	case pipedream.Error:
+		m.finished = true
+		m.failure = e.Error()
+	case pipedream.Aborted:
+		m.finished = true
+		m.failure = e.Error()
+	}
+}
+
+// part returns the part with the given number, adding it if it's new.
+func (m *tuiModel) part(number int) *tuiPart {
+	for i := range m.parts {
+		if m.parts[i].number == number {
+			return &m.parts[i]
+		}
+	}
+	m.parts = append(m.parts, tuiPart{number: number})
+	if len(m.parts) > tuiParts {
+		m.parts = m.parts[len(m.parts)-tuiParts:]
+	}
+	return &m.parts[len(m.parts)-1]
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	m.bar.Width = clamp(m.width-40, 10, maxBarWidth)
+
+	fmt.Fprintf(&b, "\n  %s Uploading to %s\n\n", arrow, m.path)
+
+	for _, p := range m.parts {
+		var percent float64
+		if p.size > 0 {
+			percent = float64(p.sent) / float64(p.size)
+		}
+		details := humanize.Bytes(uint64(p.sent))
+		if !p.done && p.size > 0 {
+			details += " of " + humanize.Bytes(uint64(p.size))
+		}
+		line := fmt.Sprintf("  %-7s %s  %s", fmt.Sprintf("#%d", p.number), m.bar.ViewAs(percent), subtle(details))
+		if p.retries > 0 {
+			line += "  " + warning(fmt.Sprintf("%d %s", p.retries, plural(p.retries, "retry", "retries")))
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(m.parts) > 0 {
+		b.WriteString("\n")
+	}
+
+	total := humanize.Bytes(uint64(m.sent))
+	if m.size > 0 {
+		total += fmt.Sprintf(" of %s, %s left", humanize.Bytes(uint64(m.size)), m.eta.Round(time.Second))
+		fmt.Fprintf(&b, "  %-7s %s  %s\n", "Total", m.bar.ViewAs(float64(m.sent)/float64(m.size)), subtle(total))
+	} else {
+		fmt.Fprintf(&b, "  %-7s %s\n", "Total", subtle(total+" so far"))
+	}
+	fmt.Fprintf(&b, "  %-7s %s  %s\n", "Speed", sparkline(m.rates, clamp(m.width-40, 10, maxGraphWidth)), subtle(humanize.Bytes(uint64(m.rate))+"/s"))
+	retries := subtle("none")
+	if m.retries > 0 {
+		retries = warning(fmt.Sprintf("%d", m.retries))
+	}
+	fmt.Fprintf(&b, "  %-7s %s\n\n", "Retries", retries)
+
+	switch {
+	case m.complete != nil && m.complete.Skipped:
+		fmt.Fprintf(&b, "  %s %s\n", check, skippedMessage())
+	case m.complete != nil:
+		s := m.complete.Summary
+		fmt.Fprintf(&b, "  %s Done. Sent %s in %s. %s\n", check, humanize.Bytes(uint64(m.complete.Bytes)), s.Duration.Round(time.Millisecond), subtle(describeSummary(s.Parts, s.Retries, s.Throughput)))
+	case m.failure != "":
+		fmt.Fprintf(&b, "  %s Upload failed: %s\n", ex, m.failure)
+	case m.cancelling:
+		b.WriteString("  " + subtle("Cancelling...") + "\n")
+	case !m.finished:
+		b.WriteString("  " + subtle("q to cancel") + "\n")
+	}
+	return b.String()
+}
+
+// sparkline draws the most recent values that fit in width as a bar graph,
+// scaled to the largest of them.
+func sparkline(values []float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var peak float64
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	b.WriteString(strings.Repeat(" ", width-len(values)))
+	return b.String()
+}
+
+func clamp(n, low, high int) int {
+	if n < low {
+		return low
+	}
+	if n > high {
+		return high
+	}
+	return n
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// webhookTimeout is how long a webhook can take before we give up on it.
+const webhookTimeout = 30 * time.Second
+
+var (
+	notifyHooks []string
+	chatHooks   []chatHook
+)
+
+// chatHook is a webhook to tell about results, given with --notify as
+// KIND=URL.
+type chatHook struct {
+	kind string
+	url  string
+}
+
+// chatPayloads turn a result into what each kind of webhook expects.
+var chatPayloads = map[string]func(runResult) any{
+	"slack":   slackPayload,
+	"discord": discordPayload,
+	"teams":   teamsPayload,
+	"webhook": webhookPayload,
+}
+
+// parseChatHooks parses the --notify flags.
+func parseChatHooks(specs []string) ([]chatHook, error) {
+	hooks := make([]chatHook, len(specs))
+	for i, spec := range specs {
+		kind, u, ok := strings.Cut(spec, "=")
+		if _, known := chatPayloads[kind]; !ok || !known {
+			return nil, fmt.Errorf("bad --notify %q; use KIND=URL, where KIND is %s", spec, chatKinds())
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("bad --notify %q; the URL must be http or https", spec)
+		}
+		hooks[i] = chatHook{kind: kind, url: u}
+	}
+	return hooks, nil
+}
+
+// chatKinds lists the kinds of webhook there are, for error messages.
+func chatKinds() string {
+	kinds := make([]string, 0, len(chatPayloads))
+	for k := range chatPayloads {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds[:len(kinds)-1], ", ") + " or " + kinds[len(kinds)-1]
+}
+
+// send posts the result to the webhook.
+func (h chatHook) send(r runResult) error {
+	b, err := json.Marshal(chatPayloads[h.kind](r))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	res, err := client.Post(h.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// The colours results are shown in, where webhooks have them.
+const (
+	successColor = 0x2eb886
+	failureColor = 0xe01e5a
+)
+
+func resultColor(r runResult) int {
+	if r.Err != nil {
+		return failureColor
+	}
+	return successColor
+}
+
+// slackPayload lays out a result as a Slack message, with its details in a
+// coloured attachment.
+func slackPayload(r runResult) any {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	var fields []field
+	for _, f := range r.facts() {
+		fields = append(fields, field{Title: f.name, Value: f.value, Short: f.name != "Error"})
+	}
+	return map[string]any{
+		"text": r.subject(),
+		"attachments": []map[string]any{{
+			"color":    fmt.Sprintf("#%06x", resultColor(r)),
+			"fallback": r.subject(),
+			"fields":   fields,
+		}},
+	}
+}
+
+// discordPayload lays out a result as a Discord embed, which has limits on
+// how long its text can be.
+func discordPayload(r runResult) any {
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	}
+	var fields []field
+	for _, f := range r.facts() {
+		fields = append(fields, field{Name: f.name, Value: truncate(f.value, 1024), Inline: f.name != "Error"})
+	}
+	return map[string]any{
+		"embeds": []map[string]any{{
+			"title":  truncate(r.subject(), 256),
+			"color":  resultColor(r),
+			"fields": fields,
+		}},
+	}
+}
+
+// teamsPayload lays out a result as a Microsoft Teams message card.
+func teamsPayload(r runResult) any {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	var facts []fact
+	for _, f := range r.facts() {
+		facts = append(facts, fact{Name: f.name, Value: f.value})
+	}
+	return map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    r.subject(),
+		"title":      r.subject(),
+		"themeColor": fmt.Sprintf("%06X", resultColor(r)),
+		"sections":   []map[string]any{{"facts": facts}},
+	}
+}
+
+// truncate shortens s to at most n characters, marking where it was cut.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// webhookPayload is the result as plain JSON, for webhooks of your own.
+func webhookPayload(r runResult) any {
+	host, _ := os.Hostname()
+	p := struct {
+		Success  bool    `json:"success"`
+		Target   string  `json:"target"`
+		Host     string  `json:"host,omitempty"`
+		Bytes    int64   `json:"bytes"`
+		Duration float64 `json:"duration_seconds"`
+		Error    string  `json:"error,omitempty"`
+	}{
+		Success:  r.Err == nil,
+		Target:   r.Target,
+		Host:     host,
+		Bytes:    r.Bytes,
+		Duration: r.Duration.Seconds(),
+	}
+	if r.Err != nil {
+		p.Error = r.Err.Error()
+	}
+	return p
+}
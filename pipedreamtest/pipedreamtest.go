@@ -0,0 +1,309 @@
+// Package pipedreamtest provides an in-memory stand-in for S3, so that code
+// which uploads with pipedream can be tested without a network or
+// credentials.
+//
+// Example usage:
+//
+//	b := pipedreamtest.NewBackend()
+//	m, _ := pipedream.New(
+//	    pipedream.WithBucket("my-fave-bucket"),
+//	    pipedream.WithBackend(b),
+//	)
+//	if _, err := m.Upload(ctx, strings.NewReader("hi"), "greeting.txt", nil); err != nil {
+//	    t.Fatal(err)
+//	}
+//	obj, ok := b.Object("my-fave-bucket", "greeting.txt")
+package pipedreamtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/meowgorithm/pipedream"
+)
+
+// Object is an object stored by a Backend.
+type Object struct {
+	Bucket      string
+	Key         string
+	Data        []byte
+	ContentType string
+	Metadata    map[string]string
+
+	// Parts are the parts the object was assembled from, in order.
+	Parts []Part
+
+	// ETag is worked out the way S3 does it for multipart uploads.
+	ETag string
+}
+
+// Part is a part of an upload.
+type Part struct {
+	Number int
+	Data   []byte
+	ETag   string
+}
+
+// Upload is a multipart upload that hasn't been completed or aborted yet.
+type Upload struct {
+	ID     string
+	Bucket string
+	Key    string
+
+	// Parts are the parts received so far, in order.
+	Parts []Part
+
+	contentType string
+	metadata    map[string]string
+	parts       map[int]Part
+}
+
+// Backend is an in-memory pipedream.Backend. It keeps the parts of each
+// upload and the objects they're assembled into, which can then be inspected.
+// The zero value isn't usable; make one with NewBackend. It's safe to use from
+// more than one goroutine.
+type Backend struct {
+	// FailPart, if set, is called before each part is stored. If it returns
+	// an error the part fails with it, which is handy for testing retries.
+	// Attempt counts from 1 for each part.
+	FailPart func(key string, partNumber, attempt int) error
+
+	mtx      sync.Mutex
+	nextID   int
+	uploads  map[string]*Upload
+	objects  map[string]Object
+	attempts map[string]int
+	aborted  []string
+}
+
+var _ pipedream.Backend = (*Backend)(nil)
+
+// NewBackend returns an empty Backend.
+func NewBackend() *Backend {
+	return &Backend{
+		uploads:  make(map[string]*Upload),
+		objects:  make(map[string]Object),
+		attempts: make(map[string]int),
+	}
+}
+
+// CreateUpload starts an upload.
+func (b *Backend) CreateUpload(_ context.Context, input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.nextID++
+	id := strconv.Itoa(b.nextID)
+	b.uploads[id] = &Upload{
+		ID:          id,
+		Bucket:      aws.StringValue(input.Bucket),
+		Key:         aws.StringValue(input.Key),
+		contentType: aws.StringValue(input.ContentType),
+		metadata:    aws.StringValueMap(input.Metadata),
+		parts:       make(map[int]Part),
+	}
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: aws.String(id),
+	}, nil
+}
+
+// UploadPart stores a part, replacing any earlier part with the same number.
+func (b *Backend) UploadPart(_ context.Context, input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	var data []byte
+	if input.Body != nil {
+		// Like the SDK, read from wherever the body is, so a part that
+		// isn't rewound before it's retried shows up as missing data.
+		var err error
+		if data, err = io.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := aws.StringValue(input.UploadId)
+	u, ok := b.uploads[id]
+	if !ok {
+		return nil, noSuchUpload(id)
+	}
+	num := int(aws.Int64Value(input.PartNumber))
+
+	if b.FailPart != nil {
+		attemptKey := id + "/" + strconv.Itoa(num)
+		b.attempts[attemptKey]++
+		if err := b.FailPart(u.Key, num, b.attempts[attemptKey]); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := md5.Sum(data)
+	p := Part{
+		Number: num,
+		Data:   data,
+		ETag:   `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+	u.parts[num] = p
+	u.Parts = sortedParts(u.parts)
+	return &s3.UploadPartOutput{ETag: aws.String(p.ETag)}, nil
+}
+
+// Complete assembles an object from the parts given, which must have been
+// uploaded and be listed in order.
+func (b *Backend) Complete(_ context.Context, input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := aws.StringValue(input.UploadId)
+	u, ok := b.uploads[id]
+	if !ok {
+		return nil, noSuchUpload(id)
+	}
+
+	var completed []*s3.CompletedPart
+	if input.MultipartUpload != nil {
+		completed = input.MultipartUpload.Parts
+	}
+	if len(completed) == 0 {
+		return nil, invalidPart("no parts were given")
+	}
+
+	var (
+		data  bytes.Buffer
+		parts []Part
+		sums  = md5.New()
+		prev  int
+	)
+	for _, cp := range completed {
+		num := int(aws.Int64Value(cp.PartNumber))
+		if num <= prev {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidPartOrder", "parts must be listed in ascending order", nil), http.StatusBadRequest, "")
+		}
+		prev = num
+		p, ok := u.parts[num]
+		if !ok {
+			return nil, invalidPart(fmt.Sprintf("part %d was never uploaded", num))
+		}
+		if aws.StringValue(cp.ETag) != p.ETag {
+			return nil, invalidPart(fmt.Sprintf("part %d has ETag %s, not %s", num, p.ETag, aws.StringValue(cp.ETag)))
+		}
+		data.Write(p.Data)
+		parts = append(parts, p)
+		sum := md5.Sum(p.Data)
+		sums.Write(sum[:])
+	}
+
+	obj := Object{
+		Bucket:      u.Bucket,
+		Key:         u.Key,
+		Data:        data.Bytes(),
+		ContentType: u.contentType,
+		Metadata:    u.metadata,
+		Parts:       parts,
+		ETag:        fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(parts)),
+	}
+	b.objects[objectKey(u.Bucket, u.Key)] = obj
+	delete(b.uploads, id)
+
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket: aws.String(obj.Bucket),
+		Key:    aws.String(obj.Key),
+		ETag:   aws.String(obj.ETag),
+	}, nil
+}
+
+// Abort discards an upload and its parts.
+func (b *Backend) Abort(_ context.Context, input *s3.AbortMultipartUploadInput) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := aws.StringValue(input.UploadId)
+	if _, ok := b.uploads[id]; !ok {
+		return noSuchUpload(id)
+	}
+	delete(b.uploads, id)
+	b.aborted = append(b.aborted, id)
+	return nil
+}
+
+// Object returns the object stored at key in bucket, if there is one.
+func (b *Backend) Object(bucket, key string) (Object, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	obj, ok := b.objects[objectKey(bucket, key)]
+	return obj, ok
+}
+
+// Objects returns every stored object, sorted by bucket and key.
+func (b *Backend) Objects() []Object {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	objs := make([]Object, 0, len(b.objects))
+	for _, obj := range b.objects {
+		objs = append(objs, obj)
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objectKey(objs[i].Bucket, objs[i].Key) < objectKey(objs[j].Bucket, objs[j].Key)
+	})
+	return objs
+}
+
+// Uploads returns the uploads that are still in progress, that is, that have
+// been neither completed nor aborted. After a finished upload, there should
+// be none.
+func (b *Backend) Uploads() []Upload {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	ups := make([]Upload, 0, len(b.uploads))
+	for _, u := range b.uploads {
+		ups = append(ups, *u)
+	}
+	sort.Slice(ups, func(i, j int) bool {
+		return ups[i].ID < ups[j].ID
+	})
+	return ups
+}
+
+// Aborted returns the IDs of the uploads that were aborted, in the order they
+// were aborted.
+func (b *Backend) Aborted() []string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return append([]string(nil), b.aborted...)
+}
+
+func objectKey(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+func sortedParts(parts map[int]Part) []Part {
+	sorted := make([]Part, 0, len(parts))
+	for _, p := range parts {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Number < sorted[j].Number
+	})
+	return sorted
+}
+
+func noSuchUpload(id string) error {
+	return awserr.NewRequestFailure(awserr.New("NoSuchUpload", "no upload with ID "+id, nil), http.StatusNotFound, "")
+}
+
+func invalidPart(msg string) error {
+	return awserr.NewRequestFailure(awserr.New("InvalidPart", msg, nil), http.StatusBadRequest, "")
+}
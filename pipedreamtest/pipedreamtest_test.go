@@ -0,0 +1,121 @@
+package pipedreamtest
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// upload creates an upload and sends the given parts, numbered from 1.
+func upload(t *testing.T, b *Backend, key string, parts ...string) (string, []*s3.CompletedPart) {
+	t.Helper()
+	ctx := context.Background()
+	res, err := b.CreateUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var completed []*s3.CompletedPart
+	for i, p := range parts {
+		part, err := b.UploadPart(ctx, &s3.UploadPartInput{
+			Body:       strings.NewReader(p),
+			UploadId:   res.UploadId,
+			PartNumber: aws.Int64(int64(i + 1)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		completed = append(completed, &s3.CompletedPart{ETag: part.ETag, PartNumber: aws.Int64(int64(i + 1))})
+	}
+	return aws.StringValue(res.UploadId), completed
+}
+
+func TestComplete(t *testing.T) {
+	b := NewBackend()
+	id, parts := upload(t, b, "k", "hello, ", "world")
+	if _, err := b.Complete(context.Background(), &s3.CompleteMultipartUploadInput{
+		UploadId:        aws.String(id),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, ok := b.Object("test", "k")
+	if !ok {
+		t.Fatal("object wasn't stored")
+	}
+	if string(obj.Data) != "hello, world" {
+		t.Errorf("got %q, want %q", obj.Data, "hello, world")
+	}
+	// The MD5 of the parts' MD5s, as S3 does it.
+	a, w := md5.Sum([]byte("hello, ")), md5.Sum([]byte("world"))
+	sum := md5.Sum(append(a[:], w[:]...))
+	if want := `"` + hex.EncodeToString(sum[:]) + `-2"`; obj.ETag != want {
+		t.Errorf("got ETag %s, want %s", obj.ETag, want)
+	}
+	if len(b.Uploads()) != 0 {
+		t.Error("completed upload is still in progress")
+	}
+}
+
+func TestCompleteChecksParts(t *testing.T) {
+	tests := []struct {
+		name   string
+		parts  func([]*s3.CompletedPart) []*s3.CompletedPart
+		reason string
+	}{
+		{"out of order", func(p []*s3.CompletedPart) []*s3.CompletedPart {
+			return []*s3.CompletedPart{p[1], p[0]}
+		}, "InvalidPartOrder"},
+		{"wrong ETag", func(p []*s3.CompletedPart) []*s3.CompletedPart {
+			return []*s3.CompletedPart{{ETag: aws.String(`"nope"`), PartNumber: p[0].PartNumber}, p[1]}
+		}, "InvalidPart"},
+		{"never uploaded", func(p []*s3.CompletedPart) []*s3.CompletedPart {
+			return append(p, &s3.CompletedPart{ETag: p[0].ETag, PartNumber: aws.Int64(3)})
+		}, "InvalidPart"},
+		{"none", func([]*s3.CompletedPart) []*s3.CompletedPart {
+			return nil
+		}, "InvalidPart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackend()
+			id, parts := upload(t, b, "k", "a", "b")
+			_, err := b.Complete(context.Background(), &s3.CompleteMultipartUploadInput{
+				UploadId:        aws.String(id),
+				MultipartUpload: &s3.CompletedMultipartUpload{Parts: tt.parts(parts)},
+			})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.reason+":") {
+				t.Errorf("got %v, want %s", err, tt.reason)
+			}
+			if _, ok := b.Object("test", "k"); ok {
+				t.Error("object was stored")
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	b := NewBackend()
+	id, _ := upload(t, b, "k", "a")
+	if err := b.Abort(context.Background(), &s3.AbortMultipartUploadInput{UploadId: aws.String(id)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Aborted(); len(got) != 1 || got[0] != id {
+		t.Errorf("got aborted uploads %v, want [%s]", got, id)
+	}
+	if len(b.Uploads()) != 0 {
+		t.Error("aborted upload is still in progress")
+	}
+	// Like S3, it's gone, so it can't be aborted again.
+	if err := b.Abort(context.Background(), &s3.AbortMultipartUploadInput{UploadId: aws.String(id)}); err == nil {
+		t.Error("aborted the same upload twice")
+	}
+}
@@ -0,0 +1,94 @@
+package pipedream
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// progressTracker keeps the running totals reported in Progress events.
+type progressTracker struct {
+	start   time.Time
+	last    time.Time
+	sent    int64
+	size    int64
+	parts   int
+	retries int
+}
+
+func newProgressTracker(size int64) *progressTracker {
+	now := time.Now()
+	return &progressTracker{start: now, last: now, size: size}
+}
+
+// progress records that a part of n bytes was sent in d, taking the given
+// number of attempts, and returns the Progress event for it.
+func (t *progressTracker) progress(partNum, n int, d time.Duration, attempts int) Progress {
+	now := time.Now()
+	t.sent += int64(n)
+	t.parts++
+
+	p := Progress{
+		PartNumber: partNum,
+		Bytes:      n,
+		Parts:      1,
+		Duration:   d,
+		Attempts:   attempts,
+		Sent:       t.sent,
+		Elapsed:    now.Sub(t.start),
+		Size:       t.size,
+	}
+	if d := now.Sub(t.last).Seconds(); d > 0 {
+		p.Rate = float64(n) / d
+	}
+	t.last = now
+
+	if t.size > 0 {
+		p.Percent = float64(t.sent) / float64(t.size) * 100
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+		if avg := float64(t.sent) / p.Elapsed.Seconds(); avg > 0 && t.sent < t.size {
+			p.ETA = time.Duration(float64(t.size-t.sent) / avg * float64(time.Second))
+		}
+	}
+	return p
+}
+
+// summary returns the totals for the upload so far.
+func (t *progressTracker) summary() Summary {
+	s := Summary{
+		Bytes:    t.sent,
+		Parts:    t.parts,
+		Retries:  t.retries,
+		Duration: time.Since(t.start),
+	}
+	if secs := s.Duration.Seconds(); secs > 0 {
+		s.Throughput = float64(s.Bytes) / secs
+	}
+	return s
+}
+
+// inputSize returns the number of bytes left to read from r, or 0 if that
+// can't be known, as with pipes.
+func inputSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0
+		}
+		return info.Size() - offset
+	case interface{ Len() int }:
+		// bytes.Reader, strings.Reader, bytes.Buffer and friends
+		return int64(r.Len())
+	case interface{ Size() int64 }:
+		// io.SectionReader
+		return r.Size()
+	}
+	return 0
+}
@@ -0,0 +1,267 @@
+package pipedream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// chunk is data read from the input, destined to become one part of the
+// upload. It's held either in memory or, when spilling to disk, in a
+// temporary file.
+type chunk struct {
+	slot *slot
+	n    int
+	err  error
+
+	// When the input can be read at an offset, src and off are set instead
+	// of slot and the chunk is read straight from the input.
+	src io.ReaderAt
+	off int64
+
+	// How long it took to read the chunk from the input
+	readTime time.Duration
+}
+
+// body returns a reader for the chunk's data.
+func (c chunk) body() io.ReadSeeker {
+	if c.src != nil {
+		return io.NewSectionReader(c.src, c.off, int64(c.n))
+	}
+	if c.slot.file != nil {
+		return io.NewSectionReader(c.slot.file, 0, int64(c.n))
+	}
+	return bytes.NewReader(c.slot.buf[:c.n])
+}
+
+// head returns up to the first 512 bytes of the chunk, which is enough to
+// detect its content type.
+func (c chunk) head() []byte {
+	size := c.n
+	if size > 512 {
+		size = 512
+	}
+	if c.src != nil {
+		b := make([]byte, size)
+		n, _ := c.src.ReadAt(b, c.off)
+		return b[:n]
+	}
+	if c.slot.file != nil {
+		b := make([]byte, size)
+		n, _ := c.slot.file.ReadAt(b, 0)
+		return b[:n]
+	}
+	return c.slot.buf[:size]
+}
+
+// slot is somewhere a chunk can be stored: a buffer or a temporary file.
+type slot struct {
+	buf  []byte
+	file *os.File
+}
+
+// fill reads up to size bytes from r into the slot.
+func (s *slot) fill(r io.Reader, size int64) (int, error) {
+	if s.file == nil {
+		if int64(cap(s.buf)) < size {
+			s.buf = make([]byte, size)
+		} else {
+			s.buf = s.buf[:size]
+		}
+		// Fill the whole buffer. A single Read on a pipe often returns far
+		// less than we asked for, which would make for lots of tiny parts,
+		// and S3 rejects any part but the last under 5MB.
+		n, err := io.ReadFull(r, s.buf)
+		if err == io.ErrUnexpectedEOF {
+			// A short, final chunk.
+			err = io.EOF
+		}
+		return n, err
+	}
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(s.file, r, size)
+	return int(n), err
+}
+
+// readAheadConfig configures readAhead.
+type readAheadConfig struct {
+	// size returns how big each part, numbered from 1, should be.
+	size func(partNum int) int64
+
+	// limiter, if not nil, counts buffered bytes against a budget. Chunks
+	// spilled to disk don't count.
+	limiter *Limiter
+
+	// spillDir, if not empty, is a directory in which to keep chunks in
+	// temporary files rather than in memory.
+	spillDir string
+}
+
+// readAhead reads chunks from r in the background so the next part is already
+// buffered by the time the current one has been sent. Two slots are used in
+// rotation; pass a chunk to release once it's been uploaded so its slot can be
+// filled again. Call stop when done to end reading and clean up.
+//
+// Every chunk but the last is full. The last chunk carries io.EOF and may
+// also carry data.
+func readAhead(r io.Reader, cfg readAheadConfig) (chunks <-chan chunk, release func(chunk), stop func(), err error) {
+	out := make(chan chunk)
+	done := make(chan struct{})
+	b := &budget{lim: cfg.limiter}
+
+	// Buffers are allocated lazily, and grown as needed, so small inputs
+	// don't cost much memory.
+	slots := []*slot{{}, {}}
+	if cfg.spillDir != "" {
+		for _, s := range slots {
+			if s.file, err = os.CreateTemp(cfg.spillDir, "pipedream-*"); err != nil {
+				removeSlots(slots)
+				return nil, nil, nil, err
+			}
+		}
+		b.lim = nil
+	}
+	free := make(chan *slot, len(slots))
+	for _, s := range slots {
+		free <- s
+	}
+
+	go func() {
+		defer close(out)
+		for partNum := 1; ; partNum++ {
+			var s *slot
+			select {
+			case s = <-free:
+			case <-done:
+				return
+			}
+
+			need := cfg.size(partNum)
+			if b.lim != nil && need > b.lim.Max() {
+				// Parts that grow as we go can outgrow the budget, and
+				// waiting for it would wait forever.
+				err := fmt.Errorf("part %d needs %d bytes, more than the limiter's budget of %d bytes", partNum, need, b.lim.Max())
+				select {
+				case out <- chunk{slot: s, err: withClass(ErrTooManyParts, err)}:
+				case <-done:
+				}
+				return
+			}
+			if !b.take(need, done) {
+				return
+			}
+
+			start := time.Now()
+			n, err := s.fill(r, need)
+			readTime := time.Since(start)
+
+			select {
+			case out <- chunk{slot: s, n: n, err: err, readTime: readTime}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	release = func(c chunk) {
+		if c.slot == nil {
+			return
+		}
+		if c.slot.file == nil {
+			b.give(int64(len(c.slot.buf)))
+			if cfg.limiter != nil {
+				// Let the memory go so the budget reflects what's really
+				// held.
+				c.slot.buf = nil
+			}
+		}
+		free <- c.slot
+	}
+	stop = func() {
+		close(done)
+		b.close()
+		removeSlots(slots)
+	}
+	return out, release, stop, nil
+}
+
+// readerAt returns r as an io.ReaderAt, along with the offset to read from and
+// how much there is to read, if it can be read that way. Files, bytes.Readers
+// and io.SectionReaders can; pipes can't.
+func readerAt(r io.Reader) (ra io.ReaderAt, offset, size int64, ok bool) {
+	ra, ok = r.(io.ReaderAt)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	size = inputSize(r)
+	if size <= 0 {
+		return nil, 0, 0, false
+	}
+	offset, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+	return ra, offset, size, true
+}
+
+// readAt splits size bytes of r, starting at offset, into chunks in the same
+// way as readAhead, except nothing is buffered: each chunk reads its part
+// straight from r when it's sent, and again at the same offset if it has to
+// be retried. r isn't read sequentially, so its position is left alone.
+func readAt(r io.ReaderAt, offset, size int64, partSize func(partNum int) int64) (chunks <-chan chunk, release func(chunk), stop func()) {
+	out := make(chan chunk)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(out)
+		end := offset + size
+		for partNum := 1; ; partNum++ {
+			c := chunk{src: r, off: offset}
+			n := partSize(partNum)
+			if offset+n >= end {
+				n = end - offset
+				c.err = io.EOF
+			}
+			c.n = int(n)
+			offset += n
+
+			select {
+			case out <- c:
+			case <-done:
+				return
+			}
+			if c.err != nil {
+				return
+			}
+		}
+	}()
+
+	release = func(chunk) {}
+	stop = func() { close(done) }
+	return out, release, stop
+}
+
+// removeSlots deletes any temporary files backing the slots.
+func removeSlots(slots []*slot) {
+	for _, s := range slots {
+		if s.file != nil {
+			s.file.Close()
+			os.Remove(s.file.Name())
+		}
+	}
+}
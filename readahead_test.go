@@ -0,0 +1,28 @@
+package pipedream
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadAheadPartBiggerThanLimiter(t *testing.T) {
+	chunks, _, stop, err := readAhead(bytes.NewReader(make([]byte, 100)), readAheadConfig{
+		size:    func(int) int64 { return 2 * Megabyte },
+		limiter: NewLimiter(Megabyte),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	select {
+	case c := <-chunks:
+		if !errors.Is(c.err, ErrTooManyParts) {
+			t.Errorf("got %v, want ErrTooManyParts", c.err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("read ahead hung waiting for the limiter")
+	}
+}
@@ -0,0 +1,51 @@
+package pipedream
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// replicate copies the uploaded object to ReplicateTo, reporting how it went
+// with a Replicated event.
+func (m *transfer) replicate(out *emitter) {
+	r := *m.ReplicateTo
+	r.setDefaults()
+
+	// A copy doesn't bring the object's ACL or Object Lock along, so give it
+	// the original's, unless the replica has its own.
+	if r.ACL == "" {
+		r.ACL = m.ACL
+	}
+	if r.ObjectLockMode == "" {
+		r.ObjectLockMode, r.RetainUntil = m.ObjectLockMode, m.RetainUntil
+	}
+	r.LegalHold = r.LegalHold || m.LegalHold
+
+	_, span := m.tracer().Start(m.ctx, "pipedream.Replicate")
+	err := m.copyTo(r)
+	if err != nil {
+		err = fmt.Errorf("could not copy to s3://%s/%s: %w", r.Bucket, m.path, classify(err))
+	}
+	endSpan(span, err)
+	out.send(Replicated{Endpoint: r.Endpoint, Bucket: r.Bucket, Key: m.path, Err: err})
+}
+
+// copyTo copies the uploaded object to r's bucket. The object is looked at
+// with the client that uploaded it, since the replica's may be for another
+// region, and only the copy itself goes through the replica's.
+func (m *transfer) copyTo(r MultipartUpload) error {
+	src, err := m.svc.HeadObjectWithContext(m.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(m.path),
+	})
+	if err != nil {
+		return err
+	}
+	svc, err := r.newClient()
+	if err != nil {
+		return err
+	}
+	return r.copyObject(svc, src, m.Bucket, m.path, m.path)
+}
@@ -0,0 +1,76 @@
+package pipedream
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// defaultMultiplier is how much the delay between retries grows by when the
+// RetryPolicy doesn't say.
+const defaultMultiplier = 2
+
+// RetryPolicy determines how long to wait before retrying a part that failed
+// to send. The zero value retries straight away, as many times as
+// MultipartUpload.MaxRetries allows.
+type RetryPolicy struct {
+	// InitialDelay is how long to wait before the first retry. Without it
+	// parts are retried straight away.
+	InitialDelay time.Duration
+
+	// Multiplier is how much the delay grows by with each retry after the
+	// first. It defaults to 2, doubling the delay each time.
+	Multiplier float64
+
+	// MaxDelay, if set, is the longest to wait between retries.
+	MaxDelay time.Duration
+
+	// MaxElapsed, if set, is how long to keep trying to send a part before
+	// giving up, even if there are retries left.
+	MaxElapsed time.Duration
+}
+
+func (p RetryPolicy) validate() error {
+	if p.InitialDelay < 0 || p.MaxDelay < 0 || p.MaxElapsed < 0 {
+		return fmt.Errorf("retry delays can't be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be at least 1, not %g", p.Multiplier)
+	}
+	return nil
+}
+
+// delay returns how long to wait before the given retry, numbered from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+	mult := p.Multiplier
+	if mult == 0 {
+		mult = defaultMultiplier
+	}
+	d := float64(p.InitialDelay) * math.Pow(mult, float64(retry-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	if d > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(d)
+}
+
+// wait waits for d, or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,60 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/meowgorithm/pipedream"
+	"github.com/meowgorithm/pipedream/pipedreamtest"
+)
+
+func TestRetriedPartIsResent(t *testing.T) {
+	for _, alg := range []pipedream.ChecksumAlgorithm{"", pipedream.ChecksumSHA256} {
+		t.Run(string(alg), func(t *testing.T) {
+			b := pipedreamtest.NewBackend()
+			b.FailPart = func(_ string, _, attempt int) error {
+				if attempt == 1 {
+					return errors.New("connection reset")
+				}
+				return nil
+			}
+			m, err := pipedream.New(
+				pipedream.WithBackend(b),
+				pipedream.WithBucket("test"),
+				pipedream.WithChecksumAlgorithm(alg),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := testData(int(pipedream.MinPartSize) + 1000)
+			var retries int
+			ch, err := m.Start(bytes.NewReader(data), "retried")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for e := range ch {
+				switch e := e.(type) {
+				case pipedream.Retry:
+					retries++
+				case pipedream.Error:
+					t.Fatal(e.Err)
+				case pipedream.Aborted:
+					t.Fatal(e.Reason)
+				}
+			}
+			if retries != 2 {
+				t.Errorf("got %d retries, want 2", retries)
+			}
+
+			obj, ok := b.Object("test", "retried")
+			if !ok {
+				t.Fatal("object wasn't uploaded")
+			}
+			if !bytes.Equal(obj.Data, data) {
+				t.Errorf("uploaded %d bytes that don't match the %d sent", len(obj.Data), len(data))
+			}
+		})
+	}
+}
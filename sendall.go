@@ -0,0 +1,147 @@
+package pipedream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// NamedReader is one of the inputs to SendAll.
+type NamedReader struct {
+	// Name identifies the input in events and takes the place of {name} in
+	// the path template.
+	Name   string
+	Reader io.Reader
+}
+
+// SourceEvent is an event from one of the uploads started by SendAll.
+type SourceEvent struct {
+	// Source is the Name of the NamedReader the event is about.
+	Source string
+
+	// Path is where the input is being uploaded to.
+	Path string
+
+	Event
+}
+
+// SendAll uploads each of the readers to the path made by replacing {name}
+// in pathTemplate with its Name. Up to jobs of them are uploaded at once;
+// anything less than 1 uploads them one after another, in order.
+//
+// Events from all of the uploads come through the one channel, tagged with
+// the input they're about, and it's closed once every upload is over. An
+// upload failing doesn't stop the others, and each one ends with its own
+// terminal event, so nothing's left out when reading until the channel
+// closes. Configuration errors, and paths that would be the same for two
+// inputs, are returned before anything's read. Abort, or ctx being done,
+// stops all of them; any that haven't started by then aren't, and end with
+// an Aborted that has no UploadID.
+func (m *MultipartUpload) SendAll(ctx context.Context, readers []NamedReader, pathTemplate string, jobs int) (chan SourceEvent, error) {
+	if len(readers) == 0 {
+		return nil, errors.New("no readers")
+	}
+	var (
+		paths = make([]string, len(readers))
+		seen  = make(map[string]string, len(readers))
+	)
+	for i, r := range readers {
+		paths[i] = strings.ReplaceAll(pathTemplate, "{name}", r.Name)
+		if err := m.check(r.Reader, paths[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		if other, ok := seen[paths[i]]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded to %s", other, r.Name, paths[i])
+		}
+		seen[paths[i]] = r.Name
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	b := &batch{cancel: cancel}
+	trackBatch(m, b)
+
+	out := make(chan SourceEvent, m.EventBuffer)
+	go func() {
+		defer close(out)
+		defer cancel(nil)
+		defer untrackBatch(m, b)
+		var (
+			wg  sync.WaitGroup
+			sem = make(chan struct{}, jobs)
+		)
+		for i, r := range readers {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				// Whatever's left isn't started, but still gets its
+				// terminal event so that nobody's left waiting for it.
+				for j := i; j < len(readers); j++ {
+					out <- SourceEvent{Source: readers[j].Name, Path: paths[j], Event: Aborted{Reason: context.Cause(ctx)}}
+				}
+				break
+			}
+			wg.Add(1)
+			go func(r NamedReader, path string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				for e := range m.SendContext(ctx, r.Reader, path) {
+					out <- SourceEvent{Source: r.Name, Path: path, Event: e}
+				}
+			}(r, paths[i])
+		}
+		wg.Wait()
+	}()
+	return out, nil
+}
+
+// batch is a SendAll in progress. Cancelling it stops it starting any more
+// uploads, and stops the ones it has started.
+type batch struct {
+	cancel context.CancelCauseFunc
+}
+
+// batches keeps track of the SendAll calls in progress for each
+// MultipartUpload, so that Abort can stop the uploads they've yet to start.
+var batches = struct {
+	sync.Mutex
+	m map[*MultipartUpload]map[*batch]struct{}
+}{m: make(map[*MultipartUpload]map[*batch]struct{})}
+
+// trackBatch records that b is in progress for m.
+func trackBatch(m *MultipartUpload, b *batch) {
+	batches.Lock()
+	defer batches.Unlock()
+	if batches.m[m] == nil {
+		batches.m[m] = make(map[*batch]struct{})
+	}
+	batches.m[m][b] = struct{}{}
+}
+
+// untrackBatch records that b has finished.
+func untrackBatch(m *MultipartUpload, b *batch) {
+	batches.Lock()
+	defer batches.Unlock()
+	delete(batches.m[m], b)
+	if len(batches.m[m]) == 0 {
+		delete(batches.m, m)
+	}
+}
+
+// trackedBatches returns the SendAll calls in progress for m.
+func trackedBatches(m *MultipartUpload) []*batch {
+	batches.Lock()
+	defer batches.Unlock()
+	bs := make([]*batch, 0, len(batches.m[m]))
+	for b := range batches.m[m] {
+		bs = append(bs, b)
+	}
+	return bs
+}
@@ -0,0 +1,105 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meowgorithm/pipedream"
+	"github.com/meowgorithm/pipedream/pipedreamtest"
+)
+
+func TestSendAllStopped(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(m *pipedream.MultipartUpload, cancel context.CancelFunc)
+		want error
+	}{
+		{"aborted", func(m *pipedream.MultipartUpload, _ context.CancelFunc) { m.Abort() }, pipedream.ErrCancelled},
+		{"context done", func(_ *pipedream.MultipartUpload, cancel context.CancelFunc) { cancel() }, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := pipedreamtest.NewBackend()
+			m, err := pipedream.New(
+				pipedream.WithBackend(b),
+				pipedream.WithBucket("test"),
+				// The first part of the first input keeps failing, and it's
+				// a long wait to try again, so it's stopped partway through.
+				pipedream.WithMaxRetries(10),
+				pipedream.WithRetryPolicy(pipedream.RetryPolicy{InitialDelay: time.Hour}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var once sync.Once
+			b.FailPart = func(_ string, _, _ int) error {
+				// This is called with the backend locked, which stopping
+				// the upload needs too.
+				once.Do(func() { go tt.stop(m, cancel) })
+				return errors.New("connection reset")
+			}
+
+			data := testData(int(pipedream.MinPartSize) + 1000)
+			readers := []pipedream.NamedReader{
+				{Name: "a", Reader: bytes.NewReader(data)},
+				{Name: "b", Reader: bytes.NewReader(data)},
+				{Name: "c", Reader: bytes.NewReader(data)},
+			}
+			ch, err := m.SendAll(ctx, readers, "dir/{name}", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Reading until the channel closes has to end, with one
+			// terminal event for each input.
+			terminal := make(map[string]pipedream.Event)
+			timeout := time.After(10 * time.Second)
+		read:
+			for {
+				select {
+				case e, ok := <-ch:
+					if !ok {
+						break read
+					}
+					if !e.Terminal() {
+						continue
+					}
+					if prev, ok := terminal[e.Source]; ok {
+						t.Errorf("%s: got %v after the terminal %v", e.Source, e.Event, prev)
+					}
+					terminal[e.Source] = e.Event
+				case <-timeout:
+					t.Fatal("channel wasn't closed")
+				}
+			}
+
+			for _, r := range readers {
+				e, ok := terminal[r.Name]
+				if !ok {
+					t.Errorf("%s: no terminal event", r.Name)
+					continue
+				}
+				aborted, ok := e.(pipedream.Aborted)
+				if !ok {
+					t.Errorf("%s: got %v, want an Aborted", r.Name, e)
+					continue
+				}
+				if !errors.Is(aborted.Reason, tt.want) {
+					t.Errorf("%s: aborted because %v, want %v", r.Name, aborted.Reason, tt.want)
+				}
+			}
+			if objs := b.Objects(); len(objs) != 0 {
+				t.Errorf("%d objects stored, want none", len(objs))
+			}
+			if ups := b.Uploads(); len(ups) != 0 {
+				t.Errorf("%d uploads left in progress", len(ups))
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package pipedream
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SignatureVersion is the version of the AWS signing process used to
+// authenticate requests.
+type SignatureVersion int
+
+// Available signature versions. SignatureV4 is the default and what S3 and
+// most S3-compatible services expect. SignatureV2 is for older gateways and
+// appliances that never learned V4; it implies path-style addressing.
+// SignatureCustom leaves signing to MultipartUpload.SignRequest, for gateways
+// with an auth scheme of their own.
+const (
+	SignatureV4 SignatureVersion = iota
+	SignatureV2
+	SignatureCustom
+)
+
+// String returns the name of the signature version.
+func (v SignatureVersion) String() string {
+	switch v {
+	case SignatureV2:
+		return "v2"
+	case SignatureCustom:
+		return "custom"
+	default:
+		return "v4"
+	}
+}
+
+// Query parameters which are part of the resource being signed in V2. Any
+// other parameters are left out of the string to sign.
+var signV2SubResources = map[string]bool{
+	"acl": true, "cors": true, "delete": true, "legal-hold": true,
+	"lifecycle": true, "location": true, "logging": true,
+	"notification": true, "object-lock": true, "partNumber": true,
+	"policy": true, "requestPayment": true, "restore": true,
+	"retention": true, "tagging": true, "torrent": true, "uploadId": true,
+	"uploads": true, "versionId": true, "versioning": true, "versions": true,
+	"website": true,
+
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+}
+
+// useSignatureV2 replaces the V4 signer on an S3 client with a V2 one.
+func useSignatureV2(svc *s3.S3) {
+	svc.Handlers.Sign.Swap(v4.SignRequestHandler.Name, request.NamedHandler{
+		Name: "pipedream.SignV2",
+		Fn:   signV2,
+	})
+}
+
+// RequestSigner adds to or signs an HTTP request to the storage service, given
+// the credentials the upload was set up with. See
+// MultipartUpload.SignRequest.
+type RequestSigner func(req *http.Request, creds credentials.Value) error
+
+// useRequestSigner has an S3 client call sign with every request. With
+// SignatureCustom it replaces the standard signer; otherwise it's called just
+// before it, so that any headers it adds are signed.
+func useRequestSigner(svc *s3.S3, sign RequestSigner, v SignatureVersion) {
+	h := request.NamedHandler{
+		Name: "pipedream.SignRequest",
+		Fn: func(r *request.Request) {
+			creds, err := r.Config.Credentials.GetWithContext(r.Context())
+			if err != nil {
+				r.Error = err
+				return
+			}
+			if err := sign(r.HTTPRequest, creds); err != nil {
+				r.Error = fmt.Errorf("could not sign request: %w", err)
+			}
+		},
+	}
+	if v == SignatureCustom {
+		svc.Handlers.Sign.Swap(v4.SignRequestHandler.Name, h)
+		return
+	}
+	svc.Handlers.Sign.PushFrontNamed(h)
+}
+
+// signV2 signs an S3 request with the legacy V2 scheme, as described in
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/RESTAuthentication.html
+func signV2(r *request.Request) {
+	if r.Config.Credentials == credentials.AnonymousCredentials {
+		return
+	}
+	creds, err := r.Config.Credentials.GetWithContext(r.Context())
+	if err != nil {
+		r.Error = err
+		return
+	}
+
+	h := r.HTTPRequest.Header
+	h.Del("X-Amz-Date")
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if creds.SessionToken != "" {
+		h.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	mac := hmac.New(sha1.New, []byte(creds.SecretAccessKey))
+	mac.Write([]byte(stringToSignV2(r.HTTPRequest)))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	h.Set("Authorization", "AWS "+creds.AccessKeyID+":"+sig)
+}
+
+func stringToSignV2(req *http.Request) string {
+	b := strings.Builder{}
+	b.WriteString(req.Method + "\n")
+	b.WriteString(req.Header.Get("Content-MD5") + "\n")
+	b.WriteString(req.Header.Get("Content-Type") + "\n")
+	b.WriteString(req.Header.Get("Date") + "\n")
+
+	// Canonicalized x-amz-* headers
+	var amzHeaders []string
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") {
+			amzHeaders = append(amzHeaders, k+":"+strings.Join(v, ","))
+		}
+	}
+	sort.Strings(amzHeaders)
+	for _, h := range amzHeaders {
+		b.WriteString(h + "\n")
+	}
+
+	// Canonicalized resource. We always use path-style addressing with V2, so
+	// the bucket is already in the path.
+	b.WriteString(req.URL.EscapedPath())
+	var subResources []string
+	for k, v := range req.URL.Query() {
+		if !signV2SubResources[k] {
+			continue
+		}
+		if len(v) > 0 && v[0] != "" {
+			k += "=" + v[0]
+		}
+		subResources = append(subResources, k)
+	}
+	sort.Strings(subResources)
+	if len(subResources) > 0 {
+		b.WriteString("?" + strings.Join(subResources, "&"))
+	}
+
+	return b.String()
+}
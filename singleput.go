@@ -0,0 +1,103 @@
+package pipedream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxPutSize is the largest object S3 accepts in a single request.
+const maxPutSize = 5 * 1024 * Megabyte
+
+// smallInput returns the whole input as a single chunk if it's smaller than
+// SinglePutThreshold. Inputs that can't be read at an offset are read up to
+// the threshold to find out, into a temporary file in spillDir if it's set and
+// otherwise into memory counted against the Limiter, as the read-ahead would.
+// If they turn out to be bigger, what was read is put back in front of the
+// rest of the input. Call done once the upload's over to clean up.
+func (m *transfer) smallInput(spillDir string) (c chunk, done func(), ok bool, err error) {
+	if ra, offset, size, ok := readerAt(m.reader); ok {
+		if size >= m.SinglePutThreshold {
+			return chunk{}, func() {}, false, nil
+		}
+		return chunk{src: ra, off: offset, n: int(size), err: io.EOF}, func() {}, true, nil
+	}
+
+	s := &slot{}
+	b := &budget{lim: m.Limiter}
+	if spillDir != "" {
+		if s.file, err = os.CreateTemp(spillDir, "pipedream-*"); err != nil {
+			return chunk{}, nil, false, fmt.Errorf("could not create spill file: %v", err)
+		}
+		b.lim = nil
+	}
+	done = func() {
+		b.close()
+		removeSlots([]*slot{s})
+	}
+	if !b.take(m.SinglePutThreshold, m.ctx.Done()) {
+		done()
+		return chunk{}, nil, false, context.Cause(m.ctx)
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	w := io.Writer(&buf)
+	if s.file != nil {
+		w = s.file
+	}
+	n, err := io.CopyN(w, m.reader, m.SinglePutThreshold)
+	s.buf = buf.Bytes()
+	c = chunk{slot: s, n: int(n), err: err, readTime: time.Since(start)}
+	if err == io.EOF {
+		return c, done, true, nil
+	}
+	if err != nil {
+		done()
+		return chunk{}, nil, false, err
+	}
+	// The read-ahead counts this against the Limiter again as it fills its
+	// parts, and would wait forever for what's held here.
+	b.close()
+	m.reader = io.MultiReader(c.body(), m.reader)
+	return chunk{}, done, false, nil
+}
+
+// sendWhole uploads a chunk holding the whole input as a single object,
+// reporting it as the only part.
+func (m *transfer) sendWhole(out *emitter, tracker *progressTracker, c chunk, waitTime time.Duration, verify *verifier) Event {
+	if err := m.beforePart(1, int64(c.n)); err != nil {
+		return Error{err}
+	}
+	sendStart := time.Now()
+	res, err := m.putObject(c.body(), int64(c.n), c.head(), verify)
+	if err != nil {
+		m.afterPart(1, nil, err)
+		return Error{err}
+	}
+	m.afterPart(1, &s3.CompletedPart{ETag: res.ETag, PartNumber: aws.Int64(1)}, nil)
+	if c.n > 0 {
+		out.send(tracker.progress(1, c.n, time.Since(sendStart), 1))
+		if m.ReportTimings {
+			out.send(Timing{
+				PartNumber:  1,
+				Bytes:       c.n,
+				ReadTime:    c.readTime,
+				WaitTime:    waitTime,
+				NetworkTime: time.Since(sendStart),
+			})
+		}
+	}
+	if verify != nil {
+		if err := m.verify(verify, res.VersionId); err != nil {
+			return Error{err}
+		}
+	}
+	return Complete{Bytes: c.n, Result: res, Summary: tracker.summary()}
+}
@@ -0,0 +1,26 @@
+package pipedream
+
+import (
+	"fmt"
+	"io"
+)
+
+// sizeLimitReader fails once more than max bytes have been read from r.
+type sizeLimitReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, tooLarge(l.max)
+	}
+	return n, err
+}
+
+func tooLarge(max int64) error {
+	return withClass(ErrTooLarge, fmt.Errorf("input is more than the limit of %d bytes", max))
+}
@@ -0,0 +1,62 @@
+package pipedream
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// sseCustomerKeySize is the size of an AES256 key, in bytes.
+const sseCustomerKeySize = 32
+
+// sseCustomer returns the encryption headers for a customer-provided key, or
+// nils if there isn't one. Leaving the MD5 nil has the SDK work it out.
+func (m MultipartUpload) sseCustomer() (algorithm, key, keyMD5 *string) {
+	if m.SSECustomerKey == "" {
+		return nil, nil, nil
+	}
+	algorithm = aws.String(s3.ServerSideEncryptionAes256)
+	if m.SSECustomerAlgorithm != "" {
+		algorithm = aws.String(m.SSECustomerAlgorithm)
+	}
+	if m.SSECustomerKeyMD5 != "" {
+		keyMD5 = aws.String(m.SSECustomerKeyMD5)
+	}
+	return algorithm, aws.String(m.SSECustomerKey), keyMD5
+}
+
+// validateSSECustomer checks the customer-provided key settings, so a key S3
+// would refuse isn't found out only once the first part has been read.
+func (m MultipartUpload) validateSSECustomer() error {
+	if m.SSECustomerKey == "" {
+		if m.SSECustomerAlgorithm != "" || m.SSECustomerKeyMD5 != "" {
+			return errors.New("SSECustomerAlgorithm and SSECustomerKeyMD5 need an SSECustomerKey")
+		}
+		return nil
+	}
+	if m.SSECustomerAlgorithm != "" && m.SSECustomerAlgorithm != s3.ServerSideEncryptionAes256 {
+		return fmt.Errorf("unknown SSE-C algorithm %q; the only one is %s", m.SSECustomerAlgorithm, s3.ServerSideEncryptionAes256)
+	}
+	if len(m.SSECustomerKey) != sseCustomerKeySize {
+		return fmt.Errorf("SSECustomerKey must be %d bytes, not %d; give the raw key rather than an encoding of it", sseCustomerKeySize, len(m.SSECustomerKey))
+	}
+	if m.SSECustomerKeyMD5 != "" {
+		sum := md5.Sum([]byte(m.SSECustomerKey))
+		if m.SSECustomerKeyMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return errors.New("SSECustomerKeyMD5 isn't the base64 encoded MD5 of SSECustomerKey")
+		}
+	}
+	if m.Backend == nil && m.Client == nil {
+		for _, e := range append([]string{m.Endpoint}, m.FailoverEndpoints...) {
+			if strings.HasPrefix(strings.ToLower(e), "http://") {
+				return fmt.Errorf("SSECustomerKey can only be sent over HTTPS, but the endpoint is %s", e)
+			}
+		}
+	}
+	return nil
+}
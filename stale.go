@@ -0,0 +1,59 @@
+package pipedream
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// abortStale aborts the incomplete multipart uploads to the upload's key that
+// were started more than AbortStaleAfter ago, such as ones left behind by
+// runs that crashed, which would otherwise be charged for indefinitely.
+func (m *transfer) abortStale() error {
+	cutoff := time.Now().Add(-m.AbortStaleAfter)
+	var stale []*s3.MultipartUpload
+	err := m.svc.ListMultipartUploadsPagesWithContext(m.ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(m.Bucket),
+		Prefix: aws.String(m.path),
+	}, func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+		for _, u := range page.Uploads {
+			// The prefix also matches longer keys.
+			if aws.StringValue(u.Key) == m.path && aws.TimeValue(u.Initiated).Before(cutoff) {
+				stale = append(stale, u)
+			}
+		}
+		return true
+	})
+	if isNoSuchUpload(err) {
+		// Some services say this when there are no uploads at all.
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not list incomplete uploads to s3://%s/%s: %w", m.Bucket, m.path, err)
+	}
+
+	for _, u := range stale {
+		_, err := m.svc.AbortMultipartUploadWithContext(m.ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(m.Bucket),
+			Key:      u.Key,
+			UploadId: u.UploadId,
+		})
+		if isNoSuchUpload(err) {
+			// It finished or was aborted in the meantime.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not abort stale upload %s: %w", aws.StringValue(u.UploadId), err)
+		}
+		if m.Logger != nil {
+			m.logger().InfoContext(m.ctx, "aborted stale upload",
+				slog.String("upload_id", aws.StringValue(u.UploadId)),
+				slog.Time("initiated", aws.TimeValue(u.Initiated)),
+			)
+		}
+	}
+	return nil
+}
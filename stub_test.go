@@ -0,0 +1,86 @@
+package pipedream_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// testData returns n bytes of random data that's the same every time.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+// stubS3 is just enough of S3 to upload to. It keeps none of the data, only
+// counts of the requests it's sent.
+type stubS3 struct {
+	mtx      sync.Mutex
+	puts     int
+	uploads  int
+	parts    int
+	complete int
+	bytes    int // sent in PUTs, which HEADs report as the object's size
+}
+
+// newStub serves a stubS3 for the length of the test and returns it with a
+// MultipartUpload set up to send to it.
+func newStub(tb testing.TB) (*stubS3, pipedream.MultipartUpload) {
+	tb.Helper()
+	stub := &stubS3{}
+	srv := httptest.NewServer(stub)
+	tb.Cleanup(srv.Close)
+	return stub, pipedream.MultipartUpload{
+		Endpoint:  srv.URL,
+		Bucket:    "test",
+		AccessKey: "a",
+		SecretKey: "b",
+		// V2 puts the bucket in the path rather than the host name, so
+		// there's nothing to resolve.
+		SignatureVersion: pipedream.SignatureV2,
+	}
+}
+
+func (s *stubS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := md5.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	q := r.URL.Query()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	switch {
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		s.parts++
+		s.bytes += len(body)
+		w.Header().Set("ETag", etag)
+	case r.Method == http.MethodPut:
+		s.puts++
+		s.bytes += len(body)
+		w.Header().Set("ETag", etag)
+	case r.Method == http.MethodHead:
+		// Like an object encrypted with a customer key, the ETag has
+		// nothing to do with the data.
+		w.Header().Set("Content-Length", fmt.Sprint(s.bytes))
+		w.Header().Set("ETag", `"00000000000000000000000000000000"`)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.uploads++
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>test</Bucket><Key>k</Key><UploadId>1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.complete++
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>test</Bucket><Key>k</Key><ETag>"x-2"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,47 @@
+package pipedream
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/meowgorithm/pipedream"
+
+// tracer returns the tracer to create spans with. Without a TracerProvider
+// the global one is used, which does nothing unless the application has set
+// one up.
+func (m MultipartUpload) tracer() trace.Tracer {
+	tp := m.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// endSpan ends a span, recording err if there was one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endUploadSpan ends the span for a whole upload according to the event the
+// upload ended with.
+func endUploadSpan(span trace.Span, e Event) {
+	switch e := e.(type) {
+	case Complete:
+		span.SetAttributes(attribute.Int("pipedream.bytes", e.Bytes))
+		endSpan(span, nil)
+	case Error:
+		endSpan(span, e.Err)
+	case Aborted:
+		span.SetAttributes(attribute.String("pipedream.upload_id", e.UploadID))
+		endSpan(span, e.Reason)
+	default:
+		endSpan(span, nil)
+	}
+}
@@ -0,0 +1,170 @@
+package pipedream
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// transfer is a single upload. It has its own copy of the settings and keeps
+// the state of the upload to itself, so uploads started from the same
+// MultipartUpload don't get in each other's way.
+type transfer struct {
+	MultipartUpload
+
+	ctx               context.Context
+	reader            io.Reader
+	path              string
+	hash              string
+	completedParts    []*s3.CompletedPart
+	currentPartNumber int
+
+	// svc is the S3 client, which is only set when uploading to S3.
+	svc *s3.S3
+
+	// cancel stops the upload, with the error given as the reason.
+	cancel context.CancelCauseFunc
+
+	// mtx guards backend, res, state and aborted, which Abort and Handle
+	// read from other goroutines.
+	mtx     sync.Mutex
+	backend Backend
+	res     *s3.CreateMultipartUploadOutput
+	state   UploadState
+	aborted bool
+}
+
+func newTransfer(ctx context.Context, m MultipartUpload, reader io.Reader, path string) *transfer {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &transfer{
+		MultipartUpload: m,
+		ctx:             ctx,
+		cancel:          cancel,
+		reader:          reader,
+		path:            path,
+	}
+}
+
+// UploadState is how far along an upload is.
+type UploadState int
+
+// Upload states.
+const (
+	// NotStarted means nothing has been created in the bucket yet, so
+	// there's nothing to clean up if the upload is stopped.
+	NotStarted UploadState = iota
+
+	// InProgress means the multipart upload has been created, or the object
+	// is being sent whole.
+	InProgress
+
+	// Done means the upload is over, whether it succeeded or not.
+	Done
+)
+
+func (s UploadState) String() string {
+	switch s {
+	case NotStarted:
+		return "not started"
+	case InProgress:
+		return "in progress"
+	case Done:
+		return "done"
+	}
+	return "unknown"
+}
+
+// setState records how far along the upload is.
+func (m *transfer) setState(s UploadState) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.state = s
+}
+
+// getState returns how far along the upload is.
+func (m *transfer) getState() UploadState {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.state
+}
+
+// setBackend sets the Backend the upload is sent to.
+func (m *transfer) setBackend(b Backend) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.backend = b
+}
+
+// setUpload records the multipart upload once it's been created.
+func (m *transfer) setUpload(res *s3.CreateMultipartUploadOutput) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.res = res
+	m.state = InProgress
+}
+
+// abortUpload aborts the multipart upload, if one has been created and it
+// hasn't been aborted already, so it's safe to call at any point and more than
+// once.
+func (m *transfer) abortUpload() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.res == nil || m.aborted {
+		return nil
+	}
+	// Abort even if the upload was cancelled, so nothing is left behind.
+	err := m.backend.Abort(context.WithoutCancel(m.ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   m.res.Bucket,
+		Key:      m.res.Key,
+		UploadId: m.res.UploadId,
+	})
+	m.aborted = err == nil
+	if err != nil {
+		// The event this ends up in is about why the upload failed, so make
+		// sure the parts left behind don't go unnoticed.
+		m.logWarning("could not abort upload", err, slog.String("upload_id", aws.StringValue(m.res.UploadId)))
+	}
+	return err
+}
+
+// transfers keeps track of the uploads in progress for each MultipartUpload,
+// so that Abort can find them.
+var transfers = struct {
+	sync.Mutex
+	m map[*MultipartUpload]map[*transfer]struct{}
+}{m: make(map[*MultipartUpload]map[*transfer]struct{})}
+
+// track records that t is in progress for m.
+func track(m *MultipartUpload, t *transfer) {
+	transfers.Lock()
+	defer transfers.Unlock()
+	if transfers.m[m] == nil {
+		transfers.m[m] = make(map[*transfer]struct{})
+	}
+	transfers.m[m][t] = struct{}{}
+}
+
+// untrack records that t has finished.
+func untrack(m *MultipartUpload, t *transfer) {
+	transfers.Lock()
+	defer transfers.Unlock()
+	delete(transfers.m[m], t)
+	if len(transfers.m[m]) == 0 {
+		delete(transfers.m, m)
+	}
+}
+
+// tracked returns the uploads in progress for m.
+func tracked(m *MultipartUpload) []*transfer {
+	transfers.Lock()
+	defer transfers.Unlock()
+	ts := make([]*transfer, 0, len(transfers.m[m]))
+	for t := range transfers.m[m] {
+		ts = append(ts, t)
+	}
+	return ts
+}
@@ -0,0 +1,56 @@
+package pipedream
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP connections used to talk to the storage
+// service. The zero value keeps Go's defaults.
+type TransportConfig struct {
+	// MaxIdleConnsPerHost is how many idle connections to keep per host. Go's
+	// default is 2, which is low when many uploads go to one endpoint.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept around.
+	IdleConnTimeout time.Duration
+
+	// ExpectContinueTimeout is how long to wait for a 100-continue response
+	// before sending a part's body anyway.
+	ExpectContinueTimeout time.Duration
+
+	// DisableExpectContinue stops sending "Expect: 100-continue" with parts.
+	// Some gateways handle it badly.
+	DisableExpectContinue bool
+
+	// DisableHTTP2 sticks to HTTP/1.1, which can be faster for bulk uploads
+	// since each part gets its own connection.
+	DisableHTTP2 bool
+}
+
+func (t TransportConfig) isZero() bool {
+	return t == TransportConfig{}
+}
+
+// httpClient returns an HTTP client using the given transport settings.
+func (t TransportConfig) httpClient() *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if t.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+		if tr.MaxIdleConns < t.MaxIdleConnsPerHost {
+			tr.MaxIdleConns = t.MaxIdleConnsPerHost
+		}
+	}
+	if t.IdleConnTimeout > 0 {
+		tr.IdleConnTimeout = t.IdleConnTimeout
+	}
+	if t.ExpectContinueTimeout > 0 {
+		tr.ExpectContinueTimeout = t.ExpectContinueTimeout
+	}
+	if t.DisableHTTP2 {
+		tr.ForceAttemptHTTP2 = false
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: tr}
+}
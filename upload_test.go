@@ -0,0 +1,253 @@
+package pipedream_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/meowgorithm/pipedream"
+	"github.com/meowgorithm/pipedream/pipedreamtest"
+)
+
+func TestUpload(t *testing.T) {
+	data := testData(int(2*pipedream.MinPartSize) + 1000)
+	inputs := []struct {
+		name string
+		r    io.Reader
+	}{
+		// Parts of a file, or anything else that can be read at an offset,
+		// are sent straight from it.
+		{"readAt", bytes.NewReader(data)},
+		// Streams are read ahead into buffers.
+		{"stream", struct{ io.Reader }{bytes.NewReader(data)}},
+	}
+	for _, in := range inputs {
+		t.Run(in.name, func(t *testing.T) {
+			b := pipedreamtest.NewBackend()
+			m, err := pipedream.New(pipedream.WithBackend(b), pipedream.WithBucket("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var progress []pipedream.Progress
+			c, err := m.Upload(context.Background(), in.r, "dir/object", func(p pipedream.Progress) {
+				progress = append(progress, p)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Bytes != len(data) {
+				t.Errorf("Complete says %d bytes, want %d", c.Bytes, len(data))
+			}
+			if len(progress) != 3 {
+				t.Errorf("got %d Progress events, want 3", len(progress))
+			} else if last := progress[2]; last.Sent != int64(len(data)) {
+				t.Errorf("last Progress says %d bytes sent, want %d", last.Sent, len(data))
+			}
+
+			obj, ok := b.Object("test", "dir/object")
+			if !ok {
+				t.Fatal("object wasn't uploaded")
+			}
+			if !bytes.Equal(obj.Data, data) {
+				t.Error("uploaded data doesn't match what was sent")
+			}
+			if len(obj.Parts) != 3 {
+				t.Errorf("object has %d parts, want 3", len(obj.Parts))
+			}
+			if got := aws.StringValue(c.Result.ETag); got != obj.ETag {
+				t.Errorf("Complete has ETag %s, want %s", got, obj.ETag)
+			}
+			if ups := b.Uploads(); len(ups) != 0 {
+				t.Errorf("%d uploads left in progress", len(ups))
+			}
+		})
+	}
+}
+
+func TestSinglePutOrMultipart(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		threshold int64
+		spill     bool
+		puts      int
+		parts     int
+	}{
+		{"smaller than a part", 1000, 0, false, 1, 0},
+		{"bigger than a part", int(pipedream.MinPartSize) + 1000, 0, false, 0, 2},
+		{"under the threshold", int(pipedream.MinPartSize) + 1000, 8 * pipedream.Megabyte, false, 1, 0},
+		{"over the threshold", int(2*pipedream.MinPartSize) + 1000, 8 * pipedream.Megabyte, false, 0, 3},
+		{"under the threshold, spilled", int(pipedream.MinPartSize) + 1000, 8 * pipedream.Megabyte, true, 1, 0},
+		{"over the threshold, spilled", int(2*pipedream.MinPartSize) + 1000, 8 * pipedream.Megabyte, true, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, m := newStub(t)
+			m.SinglePutThreshold = tt.threshold
+			if tt.threshold > 0 {
+				// Only just enough for what's read to find out whether the
+				// input's under the threshold, which has to be let go of for
+				// the parts of one that isn't.
+				m.Limiter = pipedream.NewLimiter(tt.threshold)
+			}
+			spillDir := t.TempDir()
+			if tt.spill {
+				m.SpillToDisk = true
+				m.SpillDir = spillDir
+			}
+
+			// A stream, so whether it fits in a part has to be found out by
+			// reading.
+			r := struct{ io.Reader }{bytes.NewReader(testData(tt.size))}
+			c, err := m.Upload(context.Background(), r, "k", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Bytes != tt.size {
+				t.Errorf("Complete says %d bytes, want %d", c.Bytes, tt.size)
+			}
+			if stub.puts != tt.puts || stub.parts != tt.parts {
+				t.Errorf("got %d puts and %d parts, want %d and %d", stub.puts, stub.parts, tt.puts, tt.parts)
+			}
+			if stub.bytes != tt.size {
+				t.Errorf("stub got %d bytes, want %d", stub.bytes, tt.size)
+			}
+			if multipart := tt.parts > 0; multipart != (stub.uploads == 1 && stub.complete == 1) {
+				t.Errorf("got %d multipart uploads created and %d completed", stub.uploads, stub.complete)
+			}
+			if left, _ := os.ReadDir(spillDir); len(left) > 0 {
+				t.Errorf("%d spill files left behind", len(left))
+			}
+		})
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	b := pipedreamtest.NewBackend()
+	m, err := pipedream.New(
+		pipedream.WithBackend(b),
+		pipedream.WithBucket("test"),
+		pipedream.WithMaxBytes(pipedream.MinPartSize),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Upload(context.Background(), bytes.NewReader(testData(int(2*pipedream.MinPartSize))), "big", nil)
+	if !errors.Is(err, pipedream.ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+	if _, ok := b.Object("test", "big"); ok {
+		t.Error("object was stored despite being too large")
+	}
+}
+
+func TestUploadAborted(t *testing.T) {
+	b := pipedreamtest.NewBackend()
+	b.FailPart = func(_ string, partNumber, _ int) error {
+		if partNumber == 2 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	m, err := pipedream.New(
+		pipedream.WithBackend(b),
+		pipedream.WithBucket("test"),
+		pipedream.WithMaxRetries(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Upload(context.Background(), bytes.NewReader(testData(int(2*pipedream.MinPartSize))), "aborted", nil)
+	var aborted pipedream.Aborted
+	if !errors.As(err, &aborted) {
+		t.Fatalf("got %v, want an Aborted", err)
+	}
+	if got := b.Aborted(); len(got) != 1 || got[0] != aborted.UploadID {
+		t.Errorf("backend aborted %v, want [%s]", got, aborted.UploadID)
+	}
+	if ups := b.Uploads(); len(ups) != 0 {
+		t.Errorf("%d uploads left in progress", len(ups))
+	}
+	if _, ok := b.Object("test", "aborted"); ok {
+		t.Error("object was stored despite the upload being aborted")
+	}
+}
+
+func TestUploadCancelled(t *testing.T) {
+	b := pipedreamtest.NewBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	b.FailPart = func(_ string, partNumber, _ int) error {
+		if partNumber == 1 {
+			cancel()
+		}
+		// Like the SDK, fail requests made with a cancelled context.
+		return ctx.Err()
+	}
+	m, err := pipedream.New(pipedream.WithBackend(b), pipedream.WithBucket("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Upload(ctx, bytes.NewReader(testData(int(3*pipedream.MinPartSize))), "cancelled", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if ups := b.Uploads(); len(ups) != 0 {
+		t.Errorf("%d uploads left in progress", len(ups))
+	}
+}
+
+func TestVerifySSECustomerKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string // part of the error, or "" for none
+	}{
+		// The stub's ETags never match, like those of objects encrypted
+		// with a customer key.
+		{"with a customer key", strings.Repeat("k", 32), ""},
+		{"without", "", "ETag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The SDK only sends keys over HTTPS.
+			srv := httptest.NewTLSServer(&stubS3{})
+			defer srv.Close()
+			client := s3.New(session.Must(session.NewSession(&aws.Config{
+				Endpoint:         aws.String(srv.URL),
+				Region:           aws.String("us-east-1"),
+				S3ForcePathStyle: aws.Bool(true),
+				Credentials:      credentials.NewStaticCredentials("a", "b", ""),
+			})))
+			// Set after the session's made, so that AWS_CA_BUNDLE doesn't
+			// replace the certificates that trust the server.
+			client.Config.HTTPClient = srv.Client()
+			m := pipedream.MultipartUpload{Bucket: "test", Client: client}
+			m.SSECustomerKey = tt.key
+			m.Verify = true
+
+			_, err := m.Upload(context.Background(), bytes.NewReader(testData(1000)), "k", nil)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("no error, want one about %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("got %q, want one about %q", err, tt.want)
+			}
+		})
+	}
+}
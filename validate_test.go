@@ -0,0 +1,54 @@
+package pipedream_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meowgorithm/pipedream"
+)
+
+// nopBackend is a Backend for checking settings with. It can't upload.
+type nopBackend struct{ pipedream.Backend }
+
+func TestNewValidates(t *testing.T) {
+	creds := pipedream.WithCredentials("a", "b", "")
+	tests := []struct {
+		name string
+		opts []pipedream.Option
+		want string // part of the error, or "" for none
+	}{
+		{"fine", []pipedream.Option{creds, pipedream.WithBucket("test")}, ""},
+		{"no bucket", []pipedream.Option{creds}, "missing Bucket"},
+		{"no credentials", []pipedream.Option{pipedream.WithBucket("test")}, "missing AccessKey and SecretKey"},
+		{"backend needs no credentials", []pipedream.Option{pipedream.WithBucket("test"), pipedream.WithBackend(nopBackend{})}, ""},
+		{"verify needs S3", []pipedream.Option{pipedream.WithBucket("test"), pipedream.WithBackend(nopBackend{}), pipedream.WithVerify()}, "Verify can't be used with a Backend"},
+		{"bucket with a slash", []pipedream.Option{creds, pipedream.WithBucket("test/dir")}, "slash"},
+		{"capitals on Spaces", []pipedream.Option{creds, pipedream.WithBucket("Test")}, "capital"},
+		{"capitals elsewhere", []pipedream.Option{creds, pipedream.WithBucket("Test"), pipedream.WithEndpoint("http://minio.local:9000")}, ""},
+		{"capitals on AWS", []pipedream.Option{creds, pipedream.WithBucket("Test"), pipedream.WithEndpoint("s3.amazonaws.com")}, "capital"},
+		{"capitals with path style", []pipedream.Option{creds, pipedream.WithBucket("Test"), pipedream.WithEndpoint("s3.amazonaws.com"), pipedream.WithSignatureVersion(pipedream.SignatureV2)}, ""},
+		{"bucket in AWS endpoint", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithEndpoint("test.s3.amazonaws.com")}, "has the bucket in it"},
+		{"bucket-named host elsewhere", []pipedream.Option{creds, pipedream.WithBucket("backups"), pipedream.WithEndpoint("backups.internal:9000")}, ""},
+		{"part bigger than limiter", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithLimiter(pipedream.NewLimiter(pipedream.Megabyte))}, "limiter"},
+		{"threshold bigger than limiter", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithSinglePutThreshold(8 * pipedream.Megabyte), pipedream.WithLimiter(pipedream.NewLimiter(6 * pipedream.Megabyte))}, "threshold"},
+		{"unknown checksum", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithChecksumAlgorithm("ROT13")}, "ROT13"},
+		{"bad content hash", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithContentHash("abc")}, "SHA-256"},
+		{"bad retry multiplier", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithRetryPolicy(pipedream.RetryPolicy{Multiplier: 0.5})}, "multiplier"},
+		{"negative timeout", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithTimeouts(-1, 0)}, "negative"},
+		{"part too small", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithPartSize(pipedream.Megabyte)}, "smaller than"},
+		{"small part allowed", []pipedream.Option{creds, pipedream.WithBucket("test"), pipedream.WithPartSize(pipedream.Megabyte), pipedream.WithMinimumPartSize(pipedream.Megabyte)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pipedream.New(tt.opts...)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("no error, want one about %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("got %q, want one about %q", err, tt.want)
+			}
+		})
+	}
+}
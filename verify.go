@@ -0,0 +1,146 @@
+package pipedream
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// verifier keeps the digests needed to check an upload once it's complete.
+type verifier struct {
+	whole hash.Hash // MD5 of all the data
+	parts []byte    // MD5 of each part, one after the other
+	count int
+	bytes int64
+}
+
+func newVerifier() *verifier {
+	return &verifier{whole: md5.New()}
+}
+
+// add digests a part, rewinding it afterwards.
+func (v *verifier) add(r io.ReadSeeker) error {
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(h, v.whole), r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	v.parts = h.Sum(v.parts)
+	v.count++
+	v.bytes += n
+	return nil
+}
+
+// addObject digests an object sent whole rather than in parts, rewinding it
+// afterwards.
+func (v *verifier) addObject(r io.ReadSeeker) error {
+	n, err := io.Copy(v.whole, r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	v.bytes += n
+	return nil
+}
+
+// etags returns the ETags the object should have. S3 gives multipart uploads
+// an MD5 of their parts' MD5s, but some services use a plain MD5 of the whole
+// object.
+func (v *verifier) etags() []string {
+	whole := hex.EncodeToString(v.whole.Sum(nil))
+	if v.count == 0 {
+		return []string{whole}
+	}
+	sum := md5.Sum(v.parts)
+	return []string{fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), v.count), whole}
+}
+
+// verify fetches the details of the uploaded object and checks its size, ETag
+// and, if there is one, checksum against what was sent. The ETag isn't checked
+// when the object's encrypted with SSECustomerKey.
+func (m *transfer) verify(v *verifier, versionID *string) error {
+	input := &s3.HeadObjectInput{
+		Bucket:    aws.String(m.Bucket),
+		Key:       aws.String(m.path),
+		VersionId: versionID,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = m.sseCustomer()
+	if m.ChecksumAlgorithm.flexible() {
+		input.ChecksumMode = aws.String(s3.ChecksumModeEnabled)
+	}
+	res, err := m.svc.HeadObjectWithContext(m.ctx, input)
+	if err != nil {
+		return fmt.Errorf("could not verify upload: %v", err)
+	}
+
+	if size := aws.Int64Value(res.ContentLength); size != v.bytes {
+		return fmt.Errorf("verification failed: object is %d bytes but %d were sent", size, v.bytes)
+	}
+
+	// Objects encrypted with a customer key don't get an ETag made from the
+	// data, so there's nothing to compare it with.
+	etag := strings.Trim(aws.StringValue(res.ETag), `"`)
+	if etag != "" && m.SSECustomerKey == "" && !containsString(v.etags(), etag) {
+		return fmt.Errorf("verification failed: object's ETag is %s but %s was expected", etag, v.etags()[0])
+	}
+
+	if m.ChecksumAlgorithm.flexible() && len(m.completedParts) > 0 {
+		got := m.ChecksumAlgorithm.from(checksums{
+			CRC32:  res.ChecksumCRC32,
+			CRC32C: res.ChecksumCRC32C,
+			SHA1:   res.ChecksumSHA1,
+			SHA256: res.ChecksumSHA256,
+		})
+		if got != nil {
+			want, err := m.compositeChecksum()
+			if err != nil {
+				return err
+			}
+			if *got != want {
+				return fmt.Errorf("verification failed: object's %s checksum is %s but %s was expected", m.ChecksumAlgorithm, *got, want)
+			}
+		}
+	}
+	return nil
+}
+
+// compositeChecksum returns the checksum S3 gives a multipart upload: the
+// checksum of its parts' checksums, with the number of parts on the end.
+func (m *transfer) compositeChecksum() (string, error) {
+	h := m.ChecksumAlgorithm.hash()
+	for _, p := range m.completedParts {
+		sum := m.ChecksumAlgorithm.from(checksums{
+			CRC32:  p.ChecksumCRC32,
+			CRC32C: p.ChecksumCRC32C,
+			SHA1:   p.ChecksumSHA1,
+			SHA256: p.ChecksumSHA256,
+		})
+		raw, err := base64.StdEncoding.DecodeString(aws.StringValue(sum))
+		if err != nil {
+			return "", fmt.Errorf("bad checksum for part %d: %v", aws.Int64Value(p.PartNumber), err)
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(m.completedParts)), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}